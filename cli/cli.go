@@ -6,18 +6,34 @@ import (
 	"time"
 
 	"github.com/evan-buss/openbooks/core"
+	"github.com/evan-buss/openbooks/dcc"
 	"github.com/evan-buss/openbooks/irc"
+	"github.com/evan-buss/openbooks/util"
 )
 
 type Config struct {
-	UserName  string // Username to use when connecting to IRC
-	Log       bool   // True if IRC messages should be logged
-	Dir       string
-	Server    string
-	EnableTLS bool
-	SearchBot string
-	Version   string
-	irc       *irc.Conn
+	UserName    string // Username to use when connecting to IRC
+	Account     string // Account used to identify a registered UserName
+	Password    string // Password for SASL or NickServ authentication
+	EnableSASL  bool
+	Log         bool // True if IRC messages should be logged
+	Dir         string
+	Servers     []string // IRC servers to try in order
+	EnableTLS   bool
+	Proxy       string // Proxy URL used for IRC and DCC connections
+	TLS         util.TLSOptions
+	DCCTLS      util.TLSOptions
+	PingTimeout time.Duration // How long to wait for a PONG before reconnecting
+	MaxFileSize int64         // Largest unrequested DCC offer to accept in bytes. Zero disables the limit.
+	Passive     dcc.PassiveOptions
+	Transfers   dcc.Limits // Bandwidth and concurrency limits for DCC transfers
+	SearchBot   string
+	Version     string
+	irc         *irc.Conn
+	session     *core.Session
+	requests    *core.RequestTracker
+	offers      *core.OfferPolicy
+	downloader  *core.Downloader
 }
 
 // StartInteractive instantiates the OpenBooks CLI interface
@@ -26,10 +42,9 @@ func StartInteractive(config Config) {
 	fmt.Println("          Welcome to OpenBooks         ")
 	fmt.Println("=======================================")
 
-	instantiate(&config)
-	defer config.irc.Close()
-
 	ctx, cancel := context.WithCancel(context.Background())
+	instantiate(ctx, &config)
+	defer config.irc.Close()
 	registerShutdown(config.irc, cancel)
 
 	handler := fullHandler(config)
@@ -38,52 +53,74 @@ func StartInteractive(config Config) {
 		defer file.Close()
 	}
 
-	go core.StartReader(ctx, config.irc, handler)
+	go config.session.Supervise(ctx, config.irc, handler)
 	terminalMenu(config)
 
 	<-ctx.Done()
 }
 
 func StartDownload(config Config, download string) {
-	instantiate(&config)
-	defer config.irc.Close()
 	ctx, cancel := context.WithCancel(context.Background())
+	instantiate(ctx, &config)
+	defer config.irc.Close()
 
 	handler := core.EventHandler{}
 	addEssentialHandlers(handler, &config)
-	handler[core.BookResult] = func(text string) {
+	id := config.requests.TrackDownload(download)
+	received := make(chan struct{}, 1)
+	handler[core.BookResult] = config.offers.Filter(func(req *core.Request, text string) {
+		if req == nil || req.ID != id {
+			return
+		}
+		received <- struct{}{}
 		fmt.Printf("%sReceived file response.\n", clearLine)
-		config.downloadHandler(text)
+		config.downloadHandler(req, text)
 		cancel()
-	}
+	}, func(req *core.Request, text string, err error) {
+		config.offerRejectedHandler(req, text, err)
+		if req != nil && req.ID == id {
+			cancel()
+		}
+	})
 	if config.Log {
 		file := config.setupLogger(handler)
 		defer file.Close()
 	}
 
 	fmt.Printf("Sending download request.")
-	go core.StartReader(ctx, config.irc, handler)
+	go config.session.Supervise(ctx, config.irc, handler)
 	core.DownloadBook(config.irc, download)
 	fmt.Printf("%sSent download request.", clearLine)
 	fmt.Printf("Waiting for file response.")
 
 	registerShutdown(config.irc, cancel)
-	<-ctx.Done()
+	config.waitForOffer(ctx, id, received)
 }
 
 func StartSearch(config Config, query string) {
 	nextSearchTime := getLastSearchTime().Add(15 * time.Second)
-	instantiate(&config)
-	defer config.irc.Close()
 	ctx, cancel := context.WithCancel(context.Background())
+	instantiate(ctx, &config)
+	defer config.irc.Close()
 
 	handler := core.EventHandler{}
 	addEssentialHandlers(handler, &config)
-	handler[core.SearchResult] = func(text string) {
+	id := config.requests.TrackSearch(config.SearchBot, query)
+	received := make(chan struct{}, 1)
+	handler[core.SearchResult] = config.offers.Filter(func(req *core.Request, text string) {
+		if req == nil || req.ID != id {
+			return
+		}
+		received <- struct{}{}
 		fmt.Printf("%sReceived file response.\n", clearLine)
-		config.searchHandler(text)
+		config.searchHandler(req, text)
 		cancel()
-	}
+	}, func(req *core.Request, text string, err error) {
+		config.offerRejectedHandler(req, text, err)
+		if req != nil && req.ID == id {
+			cancel()
+		}
+	})
 	handler[core.MatchesFound] = config.matchesFoundHandler
 	if config.Log {
 		file := config.setupLogger(handler)
@@ -94,7 +131,7 @@ func StartSearch(config Config, query string) {
 	warnIfServerOffline(query)
 	time.Sleep(time.Until(nextSearchTime))
 
-	go core.StartReader(ctx, config.irc, handler)
+	go config.session.Supervise(ctx, config.irc, handler)
 	core.SearchBook(config.irc, config.SearchBot, query)
 
 	setLastSearchTime()
@@ -102,5 +139,5 @@ func StartSearch(config Config, query string) {
 	fmt.Printf("Waiting for file response.")
 
 	registerShutdown(config.irc, cancel)
-	<-ctx.Done()
+	config.waitForOffer(ctx, id, received)
 }
@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/evan-buss/openbooks/core"
 	"github.com/evan-buss/openbooks/dcc"
@@ -11,36 +15,63 @@ import (
 
 // DownloadSearchResults downloads the search results
 // and sends user a response message
-func (c Config) searchHandler(text string) {
+func (c Config) searchHandler(req *core.Request, text string) {
 	download, err := dcc.ParseString(text)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	query := ""
+	if req != nil {
+		query = req.Query
+		fmt.Printf("Results for \"%s\".\n", req.Query)
+	}
 	bar := progressbar.DefaultBytes(download.Size, download.Filename)
 
-	extractedPath, err := core.DownloadExtractDCCString(c.Dir, text, bar)
-	if err != nil {
-		fmt.Println(err)
+	extractedPath, err := c.downloader.Download(context.Background(), c.irc, req, c.Dir, text, bar)
+	printDownloadError(err)
+	if extractedPath != "" {
+		printResults(os.Stdout, extractedPath, query)
 	}
 	fmt.Println("Results location: " + extractedPath)
 }
 
 // DownloadBookFile downloads the search results and sends
 // a user a response message
-func (c Config) downloadHandler(text string) {
+func (c Config) downloadHandler(req *core.Request, text string) {
 	download, err := dcc.ParseString(text)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	if req == nil {
+		fmt.Println("Received a file that wasn't requested.")
+	}
 	bar := progressbar.DefaultBytes(download.Size, download.Filename)
 
-	extractedPath, err := core.DownloadExtractDCCString(c.Dir, text, bar)
-	if err != nil {
+	extractedPath, err := c.downloader.Download(context.Background(), c.irc, req, c.Dir, text, bar)
+	printDownloadError(err)
+	fmt.Println("File location: " + extractedPath)
+}
+
+// printDownloadError prints why a download failed. Files that don't match
+// their advertised size or hash are saved anyway, so they get a warning.
+func printDownloadError(err error) {
+	var integrityErr *core.IntegrityError
+	if errors.As(err, &integrityErr) {
+		fmt.Printf("%sWARNING: %s\n", clearLine, err)
+	} else if err != nil {
 		fmt.Println(err)
 	}
-	fmt.Println("File location: " + extractedPath)
+}
+
+// offerRejected is called for DCC offers the offer policy turned down.
+func (c Config) offerRejectedHandler(req *core.Request, _ string, err error) {
+	if req == nil {
+		log.Println(err)
+		return
+	}
+	fmt.Printf("%sDownload rejected: %s\n", clearLine, err)
 }
 
 // NoResults is called when the user searches for something that
@@ -67,10 +98,60 @@ func (c Config) matchesFoundHandler(num string) {
 	fmt.Printf("Found %s search results.", num)
 }
 
-func (c Config) pingHandler(_ string) {
-	c.irc.Pong(c.Server)
+func (c Config) pingHandler(server string) {
+	c.irc.Pong(server)
+}
+
+func (c *Config) ctcpHandler(line string) {
+	responder := core.CTCPResponder{Version: c.Version}
+	if err := responder.Respond(c.irc, line); err != nil {
+		log.Println(err)
+	}
+}
+
+// Disconnected is called when the IRC connection drops unexpectedly.
+func (c *Config) disconnectedHandler(reason string) {
+	fmt.Printf("%sLost connection to %s: %s\n", clearLine, c.session.Current().Address, reason)
+}
+
+// Reconnecting is called before each attempt to re-establish the connection.
+func (c *Config) reconnectingHandler(delay string) {
+	fmt.Printf("%sReconnecting in %s.", clearLine, delay)
+}
+
+// Reconnected is called once the connection has been re-established.
+func (c *Config) reconnectedHandler(address string) {
+	fmt.Printf("%sReconnected to %s.\n", clearLine, address)
+}
+
+// ReconnectFailed is called when every reconnect attempt has failed. There is
+// nothing left to do so the program exits.
+func (c *Config) reconnectFailedHandler(reason string) {
+	fmt.Printf("%sUnable to reconnect to %s: %s\n", clearLine, c.session.Current().Address, reason)
+	os.Exit(1)
 }
 
-func (c *Config) versionHandler(line string) {
-	core.SendVersionInfo(c.irc, line, c.Version)
+// AuthSucceeded is called when SASL or NickServ accepts the password.
+func (c *Config) authSucceededHandler(_ string) {
+	fmt.Printf("%sIdentified as %s.\n", clearLine, c.irc.Username)
+}
+
+// AuthFailed is called when SASL or NickServ rejects the password.
+func (c *Config) authFailedHandler(reason string) {
+	fmt.Printf("%sAuthentication failed: %s\n", clearLine, reason)
+}
+
+// printHealth shows the state of the IRC connection.
+func (c Config) printHealth() {
+	if !c.irc.IsConnected() {
+		fmt.Println("\nDisconnected.")
+		return
+	}
+
+	fmt.Printf("\nConnected to %s as %s.\n", c.session.Current().Address, c.irc.Username)
+	if lag := c.irc.Lag(); lag > 0 {
+		fmt.Printf("Lag: %s\n", lag.Round(time.Millisecond))
+	} else {
+		fmt.Println("Lag: not measured yet")
+	}
 }
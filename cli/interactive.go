@@ -11,7 +11,7 @@ import (
 )
 
 func terminalMenu(config Config) {
-	fmt.Print("\ns)search\ng)et book\nse)rvers\nd)one\n~> ")
+	fmt.Print("\ns)search\ng)et book\nse)rvers\nh)ealth\nd)one\n~> ")
 
 	// Trim user input so we don't send 2 messages
 	clean := func(message string) string { return strings.Trim(message, "\r\n") }
@@ -29,11 +29,13 @@ func terminalMenu(config Config) {
 		nextSearchTime := getLastSearchTime().Add(15 * time.Second)
 		time.Sleep(time.Until(nextSearchTime))
 
+		config.requests.TrackSearch(config.SearchBot, clean(query))
 		core.SearchBook(config.irc, config.SearchBot, clean(query))
 		setLastSearchTime()
 	case "g":
 		fmt.Print("Download String: ")
 		message, _ := reader.ReadString('\n')
+		config.requests.TrackDownload(clean(message))
 		core.DownloadBook(config.irc, clean(message))
 		fmt.Println("\nSent download request.")
 		warnIfServerOffline(clean(message))
@@ -43,6 +45,9 @@ func terminalMenu(config Config) {
 			fmt.Printf("  %s\n", server)
 		}
 		terminalMenu(config)
+	case "h":
+		config.printHealth()
+		terminalMenu(config)
 	case "d":
 		fmt.Println("Disconnecting.")
 		config.irc.Disconnect()
@@ -61,14 +66,14 @@ func fullHandler(config Config) core.EventHandler {
 		config.badServerHandler(text)
 		terminalMenu(config)
 	}
-	handler[core.BookResult] = func(text string) {
-		config.downloadHandler(text)
+	handler[core.BookResult] = config.offers.Filter(func(req *core.Request, text string) {
+		config.downloadHandler(req, text)
 		terminalMenu(config)
-	}
-	handler[core.SearchResult] = func(text string) {
-		config.searchHandler(text)
+	}, config.offerRejectedHandler)
+	handler[core.SearchResult] = config.offers.Filter(func(req *core.Request, text string) {
+		config.searchHandler(req, text)
 		terminalMenu(config)
-	}
+	}, config.offerRejectedHandler)
 	handler[core.SearchAccepted] = config.searchAcceptedHandler
 	handler[core.NoResults] = func(text string) {
 		config.noResultsHandler(text)
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/evan-buss/openbooks/core"
+)
+
+// printResults parses a search results file and prints each book once with
+// the servers that offer it, most relevant to query first. The lines can be
+// pasted into "get book".
+func printResults(w io.Writer, resultsPath, query string) {
+	books, _, err := core.ParseSearchFile(resultsPath)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	core.RankBooks(books, query, servers)
+	groups := core.GroupBooks(books, servers)
+	fmt.Fprintf(w, "%d results for %d books.\n", len(books), len(groups))
+	for _, group := range groups {
+		fmt.Fprintf(w, "\n%s - %s (%s)\n", group.Author, group.Title, group.Format)
+		for _, mirror := range group.Mirrors {
+			status := "offline"
+			if mirror.Online {
+				status = "online"
+			}
+			fmt.Fprintf(w, "  %-8s %-11s %s\n", status, mirror.Size, mirror.Full)
+		}
+	}
+	fmt.Fprintln(w)
+}
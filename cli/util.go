@@ -14,7 +14,9 @@ import (
 	"time"
 
 	"github.com/evan-buss/openbooks/core"
+	"github.com/evan-buss/openbooks/dcc"
 	"github.com/evan-buss/openbooks/irc"
+	"github.com/evan-buss/openbooks/proxy"
 	"github.com/evan-buss/openbooks/util"
 )
 
@@ -34,26 +36,71 @@ func registerShutdown(conn *irc.Conn, cancel context.CancelFunc) {
 }
 
 // Connect to IRC server and save connection to Config
-func instantiate(config *Config) {
-	fmt.Printf("Connecting to %s.", config.Server)
+func instantiate(ctx context.Context, config *Config) {
+	dialer, err := proxy.FromURL(config.Proxy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tlsConfig, err := config.TLS.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Bots use self-signed certificates, so a matching pin is enough
+	dccTLS := config.DCCTLS
+	dccTLS.TrustPins = true
+	dccTLSConfig, err := dccTLS.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoints, err := core.ParseEndpoints(config.Servers, config.EnableTLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := config.Passive.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	config.session = core.NewSession(endpoints, core.DefaultBackoff)
+	config.requests = core.NewRequestTracker()
+	config.offers = core.NewOfferPolicy(config.requests, config.MaxFileSize)
+	config.downloader = core.NewDownloader(dialer)
+	config.downloader.Passive = config.Passive
+	config.downloader.Transfers = dcc.NewManager(config.Transfers)
+	config.downloader.TLSConfig = dccTLSConfig
+
+	fmt.Printf("Connecting to %s.", config.session.Current().Address)
 	conn := irc.New(config.UserName, config.Version)
+	conn.Account = config.Account
+	conn.Password = config.Password
+	conn.SASL = config.EnableSASL
+	conn.Dialer = dialer
+	conn.TLSConfig = tlsConfig
+	conn.PingTimeout = config.PingTimeout
 	config.irc = conn
-	err := core.Join(conn, config.Server, config.EnableTLS)
+	err = config.session.Join(ctx, conn)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("%sConnected to %s.\n", clearLine, config.Server)
+	fmt.Printf("%sConnected to %s.\n", clearLine, config.session.Current().Address)
 }
 
 // Required handlers are used regardless of what CLI mode is selected.
 // Keep alive pings and other core IRC client features
 func addEssentialHandlers(handler core.EventHandler, config *Config) {
 	handler[core.Ping] = config.pingHandler
-	handler[core.Version] = config.versionHandler
+	handler[core.DCCAccept] = config.downloader.Accept
+	handler[core.CTCPQuery] = config.ctcpHandler
 	handler[core.ServerList] = func(text string) {
 		servers = core.ParseServers(text).ElevatedUsers
+		config.offers.SetElevatedUsers(servers)
 	}
+	handler[core.Disconnected] = config.disconnectedHandler
+	handler[core.Reconnecting] = config.reconnectingHandler
+	handler[core.Reconnected] = config.reconnectedHandler
+	handler[core.ReconnectFailed] = config.reconnectFailedHandler
+	handler[core.AuthSucceeded] = config.authSucceededHandler
+	handler[core.AuthFailed] = config.authFailedHandler
 }
 
 func (config *Config) setupLogger(handler core.EventHandler) io.Closer {
@@ -68,6 +115,23 @@ func (config *Config) setupLogger(handler core.EventHandler) io.Closer {
 	return file
 }
 
+// waitForOffer blocks until ctx is done. If the offer for request id isn't
+// received within the tracker's TTL the request is dropped and an error is
+// printed instead.
+func (config *Config) waitForOffer(ctx context.Context, id string, received <-chan struct{}) {
+	timer := time.NewTimer(config.requests.TTL)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-received:
+		<-ctx.Done()
+	case <-timer.C:
+		config.requests.Cancel(id)
+		fmt.Printf("%sError: no matching offer received within %s.\n", clearLine, config.requests.TTL)
+	}
+}
+
 // Show warning message if the server they are downloading from is not online.
 func warnIfServerOffline(bookLine string) {
 	for _, server := range servers {
@@ -11,12 +11,6 @@ import (
 func main() {
 	ready := make(chan struct{})
 
-	ircServer := mock.IrcServer{
-		Port: ":6667",
-	}
-	go ircServer.Start(ready)
-	<-ready
-
 	greatGatsby, err := os.Open("great-gatsby.epub")
 	if err != nil {
 		panic(err)
@@ -43,6 +37,16 @@ func main() {
 	go dccSearch.Start(ready)
 	<-ready
 
+	ircServer := mock.IrcServer{
+		Port: ":6667",
+		DCC: map[string]*mock.DccServer{
+			"6669": &dccConfig,
+			"6668": &dccSearch,
+		},
+	}
+	go ircServer.Start(ready)
+	<-ready
+
 	fmt.Println("waiting")
 	time.Sleep(time.Hour * 24)
 }
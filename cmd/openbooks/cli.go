@@ -30,12 +30,23 @@ var cliCmd = &cobra.Command{
 	Use:   "cli",
 	Short: "Run openbooks from the terminal in interactive CLI mode.",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		loadGlobalEnv()
 		cliConfig.Version = globalFlags.UserAgent
 		cliConfig.UserName = globalFlags.UserName
-		cliConfig.Server = globalFlags.Server
+		cliConfig.Account = globalFlags.Account
+		cliConfig.Password = globalFlags.Password
+		cliConfig.EnableSASL = globalFlags.EnableSASL
+		cliConfig.Servers = globalFlags.Servers
 		cliConfig.Log = globalFlags.Log
 		cliConfig.SearchBot = globalFlags.SearchBot
 		cliConfig.EnableTLS = globalFlags.EnableTLS
+		cliConfig.Proxy = globalFlags.Proxy
+		cliConfig.TLS = globalFlags.TLS
+		cliConfig.DCCTLS = globalFlags.DCCTLS
+		cliConfig.PingTimeout = globalFlags.PingTimeout
+		cliConfig.MaxFileSize = int64(globalFlags.MaxFileSize) << 20
+		cliConfig.Passive = globalFlags.Passive
+		cliConfig.Transfers = transferLimits()
 
 		if debug {
 			spew.Dump(cliConfig)
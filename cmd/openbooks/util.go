@@ -1,20 +1,57 @@
 package main
 
 import (
+	"os"
 	"path"
 	"time"
 
+	"github.com/evan-buss/openbooks/dcc"
 	"github.com/evan-buss/openbooks/server"
 )
 
 // Update a server config struct from globalFlags
 func bindGlobalServerFlags(config *server.Config) {
+	loadGlobalEnv()
 	config.UserAgent = globalFlags.UserAgent
 	config.UserName = globalFlags.UserName
+	config.Account = globalFlags.Account
+	config.Password = globalFlags.Password
+	config.EnableSASL = globalFlags.EnableSASL
 	config.Log = globalFlags.Log
-	config.Server = globalFlags.Server
+	config.Servers = globalFlags.Servers
 	config.SearchBot = globalFlags.SearchBot
 	config.EnableTLS = globalFlags.EnableTLS
+	config.Proxy = globalFlags.Proxy
+	config.TLS = globalFlags.TLS
+	config.DCCTLS = globalFlags.DCCTLS
+	config.PingTimeout = globalFlags.PingTimeout
+	config.MaxFileSize = int64(globalFlags.MaxFileSize) << 20
+	config.Passive = globalFlags.Passive
+	config.Transfers = transferLimits()
+}
+
+// transferLimits converts the KiB/s flags to dcc.Limits.
+func transferLimits() dcc.Limits {
+	return dcc.Limits{
+		Rate:          int64(globalFlags.DownloadRate) << 10,
+		TransferRate:  int64(globalFlags.TransferRate) << 10,
+		MaxConcurrent: globalFlags.MaxTransfers,
+	}
+}
+
+// Read IRC credentials and the proxy URL from the environment when they
+// weren't passed as flags, so passwords don't need to appear in the process
+// list.
+func loadGlobalEnv() {
+	if globalFlags.Account == "" {
+		globalFlags.Account = os.Getenv("IRC_ACCOUNT")
+	}
+	if globalFlags.Password == "" {
+		globalFlags.Password = os.Getenv("IRC_PASSWORD")
+	}
+	if globalFlags.Proxy == "" {
+		globalFlags.Proxy = os.Getenv("PROXY_URL")
+	}
 }
 
 // Make sure the server config has a valid rate limit.
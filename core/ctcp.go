@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/evan-buss/openbooks/irc"
+)
+
+// DefaultSource is the SOURCE reply when a CTCPResponder doesn't set one.
+const DefaultSource = "https://github.com/evan-buss/openbooks"
+
+// ctcpQueries are the CTCP queries a CTCPResponder answers. Sorted for the
+// CLIENTINFO reply.
+var ctcpQueries = []string{
+	irc.CTCPClientInfo,
+	irc.CTCPPing,
+	irc.CTCPSource,
+	irc.CTCPTime,
+	irc.CTCPVersion,
+}
+
+var (
+	ErrNotCTCP     = errors.New("message is not a CTCP query")
+	ErrUnknownCTCP = errors.New("unsupported CTCP query")
+)
+
+// CTCPResponder answers the standard CTCP queries (VERSION, PING, TIME,
+// CLIENTINFO and SOURCE).
+type CTCPResponder struct {
+	// Version is the VERSION reply. IRC operators may use it to permit or
+	// block clients.
+	Version string
+	// Source is the SOURCE reply. Defaults to DefaultSource.
+	Source string
+	// Now returns the time for TIME replies. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Reply returns the reply to query. It returns false for queries that
+// aren't answered.
+func (r CTCPResponder) Reply(query irc.CTCP) (irc.CTCP, bool) {
+	reply := irc.CTCP{Command: query.Command}
+
+	switch query.Command {
+	case irc.CTCPVersion:
+		reply.Params = r.Version
+	case irc.CTCPPing:
+		// PING replies echo the sender's token so they can measure lag
+		reply.Params = query.Params
+	case irc.CTCPTime:
+		now := time.Now
+		if r.Now != nil {
+			now = r.Now
+		}
+		reply.Params = now().Format(time.RFC1123Z)
+	case irc.CTCPClientInfo:
+		reply.Params = strings.Join(ctcpQueries, " ")
+	case irc.CTCPSource:
+		reply.Params = r.Source
+		if reply.Params == "" {
+			reply.Params = DefaultSource
+		}
+	default:
+		return irc.CTCP{}, false
+	}
+
+	return reply, true
+}
+
+// Respond parses the raw CTCPQuery line and sends the reply to its sender.
+func (r CTCPResponder) Respond(conn *irc.Conn, line string) error {
+	msg, err := irc.ParseMessage(line)
+	if err != nil {
+		return err
+	}
+
+	query, ok := msg.CTCP()
+	if !ok || msg.Command != irc.CmdPrivmsg {
+		return ErrNotCTCP
+	}
+
+	reply, ok := r.Reply(query)
+	if !ok {
+		return ErrUnknownCTCP
+	}
+
+	conn.SendCTCPReply(msg.Nick(), reply)
+	return nil
+}
+
+// isCTCPQuery reports whether the responder answers command.
+func isCTCPQuery(command string) bool {
+	for _, query := range ctcpQueries {
+		if query == command {
+			return true
+		}
+	}
+	return false
+}
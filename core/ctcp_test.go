@@ -0,0 +1,42 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCTCPReply(t *testing.T) {
+	now := time.Date(2022, time.March, 4, 12, 30, 0, 0, time.UTC)
+	responder := CTCPResponder{Version: "OpenBooks 4.3.0", Now: func() time.Time { return now }}
+
+	cases := []struct {
+		query irc.CTCP
+		reply irc.CTCP
+		ok    bool
+	}{
+		{irc.CTCP{Command: "VERSION"}, irc.CTCP{Command: "VERSION", Params: "OpenBooks 4.3.0"}, true},
+		{irc.CTCP{Command: "PING", Params: "1699999999 123"}, irc.CTCP{Command: "PING", Params: "1699999999 123"}, true},
+		{irc.CTCP{Command: "TIME"}, irc.CTCP{Command: "TIME", Params: "Fri, 04 Mar 2022 12:30:00 +0000"}, true},
+		{irc.CTCP{Command: "CLIENTINFO"}, irc.CTCP{Command: "CLIENTINFO", Params: "CLIENTINFO PING SOURCE TIME VERSION"}, true},
+		{irc.CTCP{Command: "SOURCE"}, irc.CTCP{Command: "SOURCE", Params: DefaultSource}, true},
+		{irc.CTCP{Command: "USERINFO"}, irc.CTCP{}, false},
+	}
+
+	for _, c := range cases {
+		reply, ok := responder.Reply(c.query)
+		assert.Equal(t, c.ok, ok, c.query.Command)
+		assert.Equal(t, c.reply, reply, c.query.Command)
+	}
+}
+
+func TestCTCPRespondErrors(t *testing.T) {
+	responder := CTCPResponder{Version: "OpenBooks 4.3.0"}
+	conn := irc.New("evan_bot", "OpenBooks")
+
+	assert.ErrorIs(t, responder.Respond(conn, ":mock!mock@ihw-1x2 PRIVMSG evan_bot :hello"), ErrNotCTCP)
+	assert.ErrorIs(t, responder.Respond(conn, ":mock!mock@ihw-1x2 NOTICE evan_bot :\x01VERSION\x01"), ErrNotCTCP)
+	assert.ErrorIs(t, responder.Respond(conn, ":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01USERINFO\x01"), ErrUnknownCTCP)
+}
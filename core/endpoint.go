@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	defaultPort    = "6667"
+	defaultTLSPort = "6697"
+)
+
+// Endpoint is a single IRC server address and whether to connect with TLS.
+type Endpoint struct {
+	Address string
+	TLS     bool
+}
+
+// String formats the endpoint in the ircs:// or irc:// form accepted by
+// ParseEndpoints.
+func (e Endpoint) String() string {
+	if e.TLS {
+		return "ircs://" + e.Address
+	}
+	return "irc://" + e.Address
+}
+
+// ParseEndpoints parses an ordered list of IRC servers. Each entry is either
+// "host:port", which uses defaultTLS, or has an ircs:// (TLS) or irc://
+// (plain text) scheme. The port defaults to 6697 with TLS and 6667 without.
+func ParseEndpoints(servers []string, defaultTLS bool) ([]Endpoint, error) {
+	endpoints := make([]Endpoint, 0, len(servers))
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+
+		endpoint := Endpoint{Address: server, TLS: defaultTLS}
+		if scheme, rest, found := strings.Cut(server, "://"); found {
+			switch strings.ToLower(scheme) {
+			case "ircs":
+				endpoint.TLS = true
+			case "irc":
+				endpoint.TLS = false
+			default:
+				return nil, fmt.Errorf("invalid server %q: unknown scheme %q. use irc:// or ircs://", server, scheme)
+			}
+			endpoint.Address = strings.TrimSuffix(rest, "/")
+		}
+
+		if _, _, err := net.SplitHostPort(endpoint.Address); err != nil {
+			port := defaultPort
+			if endpoint.TLS {
+				port = defaultTLSPort
+			}
+			endpoint.Address = net.JoinHostPort(strings.Trim(endpoint.Address, "[]"), port)
+		}
+
+		host, _, _ := net.SplitHostPort(endpoint.Address)
+		if host == "" {
+			return nil, fmt.Errorf("invalid server %q: missing host", server)
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no IRC server configured")
+	}
+	return endpoints, nil
+}
@@ -1,40 +1,191 @@
 package core
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/evan-buss/openbooks/dcc"
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/evan-buss/openbooks/proxy"
 	"github.com/evan-buss/openbooks/util"
 )
 
-func DownloadExtractDCCString(baseDir, dccStr string, progress io.Writer) (string, error) {
-	// Download the file and wait until it is completed
+// ErrPassiveOffer is returned for passive offers that can't be answered.
+var ErrPassiveOffer = errors.New("unable to answer passive DCC offer")
+
+// DefaultResumeTimeout is how long to wait for a sender to accept a DCC
+// RESUME before downloading the whole file again.
+const DefaultResumeTimeout = 30 * time.Second
+
+// Downloader saves DCC offers to disk. Transfers that were interrupted are
+// resumed with a mIRC style DCC RESUME when the sender supports it.
+type Downloader struct {
+	// Dialer connects to the sender. Defaults to proxy.Direct.
+	Dialer proxy.Dialer
+	// ResumeTimeout defaults to DefaultResumeTimeout.
+	ResumeTimeout time.Duration
+	// Passive configures the listener for passive (port 0) offers.
+	Passive dcc.PassiveOptions
+	// IdleTimeout aborts transfers that stop sending data. Defaults to
+	// dcc.DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// Ack selects the acknowledgements sent while receiving.
+	Ack dcc.AckMode
+	// TLSConfig verifies senders of DCC SSEND offers. Bots use self-signed
+	// certificates, so keep it separate from the IRC connection's config.
+	TLSConfig *tls.Config
+	// Transfers applies bandwidth and concurrency limits when set. Share one
+	// manager between downloaders for the limits to cover all of them.
+	Transfers *dcc.Manager
+
+	mu sync.Mutex
+	// Transfers waiting for a DCC ACCEPT, by port
+	accepts map[string]chan int64
+}
+
+func NewDownloader(dialer proxy.Dialer) *Downloader {
+	return &Downloader{Dialer: dialer, ResumeTimeout: DefaultResumeTimeout}
+}
+
+// partials are the .temp files transfers in this process are writing.
+// Downloaders belong to one client but share the download directory, so a
+// partial that is in use must not be resumed by another transfer.
+var partials = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// claimPartial marks path as in use. It returns false if another transfer
+// already has it.
+func claimPartial(path string) bool {
+	partials.Lock()
+	defer partials.Unlock()
+	if partials.paths[path] {
+		return false
+	}
+	partials.paths[path] = true
+	return true
+}
+
+func releasePartial(path string) {
+	partials.Lock()
+	delete(partials.paths, path)
+	partials.Unlock()
+}
+
+// offerSizePath is where the size of the offer a .temp file belongs to is
+// kept. The leading dot and .temp extension hide it from the library.
+func offerSizePath(partialPath string) string {
+	return filepath.Join(filepath.Dir(partialPath), "."+filepath.Base(partialPath))
+}
+
+// offerSize returns the size of the offer a .temp file was created for, or
+// -1 if it wasn't recorded.
+func offerSize(partialPath string) int64 {
+	data, err := os.ReadFile(offerSizePath(partialPath))
+	if err != nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// resumableProgress is implemented by progress bars that can skip the bytes
+// a resumed transfer already has.
+type resumableProgress interface {
+	Add64(int64) error
+}
+
+// Download saves the file offered by the DCC SEND line in dccStr to baseDir
+// and extracts it if it is an archive. If a smaller .temp file from an
+// earlier attempt at an offer with the same name and size exists, and no
+// other transfer is writing it, the sender is asked over conn to resume
+// from its end. Passive offers are answered over conn with a listener opened from
+// Passive. Pass a nil conn to always download the whole file. The transfer
+// stops when ctx is cancelled.
+//
+// The file is checked against the size of the offer and the size and hash
+// req advertises. A file that fails the check is still saved, and its path
+// is returned with an *IntegrityError.
+func (d *Downloader) Download(ctx context.Context, conn *irc.Conn, req *Request, baseDir, dccStr string, progress io.Writer) (string, error) {
 	download, err := dcc.ParseString(dccStr)
 	if err != nil {
 		return "", err
 	}
+	if download.Passive() && conn == nil {
+		return "", ErrPassiveOffer
+	}
+	if download.Passive() && download.Secure {
+		return "", dcc.ErrSecurePassive
+	}
 
-	dccPath := filepath.Join(baseDir, download.Filename+".temp")
-	file, err := os.Create(dccPath)
+	// Wait for a slot before the sender is asked to connect or resume, so it
+	// isn't left hanging while queued
+	if d.Transfers != nil {
+		if err := d.Transfers.Acquire(ctx); err != nil {
+			return "", err
+		}
+		defer d.Transfers.Release()
+	}
+
+	opts := dcc.Options{Dialer: d.Dialer, IdleTimeout: d.IdleTimeout, Ack: d.Ack, TLSConfig: d.TLSConfig}
+	file, dccPath, offset, err := d.openTemp(ctx, conn, baseDir, dccStr, download)
 	if err != nil {
 		return "", err
 	}
+	defer releasePartial(dccPath)
+	defer file.Close()
+	opts.Offset = offset
+
+	if download.Passive() {
+		listener, err := d.listen(conn, dccStr, download)
+		if err != nil {
+			return "", err
+		}
+		defer listener.Close()
+		opts.Listener = listener
+	}
+
+	if p, ok := progress.(resumableProgress); ok && offset > 0 {
+		p.Add64(offset)
+	}
 
 	writer := io.Writer(file)
 	if progress != nil {
 		writer = io.MultiWriter(file, progress)
 	}
+	if d.Transfers != nil {
+		writer = d.Transfers.Throttle(ctx, writer)
+	}
 
 	// Download DCC data to the file
-	err = download.Download(writer)
-	if err != nil {
+	if err := download.DownloadContext(ctx, writer, opts); err != nil {
 		return "", err
 	}
 	file.Close()
+	os.Remove(offerSizePath(dccPath))
+
+	// Archives are checked before extraction since that's what was hashed
+	verifyErr := verifyFile(dccPath, download.Filename, download.Size, req)
+	var integrityErr *IntegrityError
+	if verifyErr != nil && !errors.As(verifyErr, &integrityErr) {
+		return "", verifyErr
+	}
+
 	if !util.IsArchive(dccPath) {
-		return renameTempFile(dccPath), nil
+		return renameTempFile(dccPath), verifyErr
 	}
 
 	extractedPath, err := util.ExtractArchive(dccPath)
@@ -42,7 +193,182 @@ func DownloadExtractDCCString(baseDir, dccStr string, progress io.Writer) (strin
 		return "", err
 	}
 
-	return renameTempFile(extractedPath), nil
+	return renameTempFile(extractedPath), verifyErr
+}
+
+// openTemp opens the .temp file download is written to and returns the
+// offset the transfer starts at. A partial file left by an interrupted
+// transfer of the same offer is reused when the sender agrees to resume it.
+// Otherwise a new file with a unique name is created. The returned path is
+// claimed and must be released with releasePartial.
+func (d *Downloader) openTemp(ctx context.Context, conn *irc.Conn, baseDir, dccStr string, download *dcc.Download) (*os.File, string, int64, error) {
+	// The name comes from the sender so it can't be trusted
+	name, err := util.SanitizeFilename(download.Filename)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	partialPath, err := util.SafeJoin(baseDir, name+".temp")
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	// Passive transfers are never resumed since their port is unknown
+	if conn != nil && !download.Passive() && claimPartial(partialPath) {
+		file, offset, err := d.reopen(ctx, conn, partialPath, dccStr, download)
+		if err != nil || file != nil {
+			if err != nil {
+				releasePartial(partialPath)
+			}
+			return file, partialPath, offset, err
+		}
+		releasePartial(partialPath)
+	}
+
+	// Picking a name and claiming it happen together so two transfers of
+	// the same file get different names
+	partials.Lock()
+	defer partials.Unlock()
+	dccPath, err := util.UniquePath(baseDir, name)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	dccPath += ".temp"
+	file, err := os.Create(dccPath)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if err := os.WriteFile(offerSizePath(dccPath), []byte(strconv.FormatInt(download.Size, 10)), 0644); err != nil {
+		file.Close()
+		return nil, "", 0, err
+	}
+	partials.paths[dccPath] = true
+	return file, dccPath, 0, nil
+}
+
+// reopen resumes the partial file at partialPath if it was left by an offer
+// of the same size. A nil file is returned when it can't be resumed.
+func (d *Downloader) reopen(ctx context.Context, conn *irc.Conn, partialPath, dccStr string, download *dcc.Download) (*os.File, int64, error) {
+	info, err := os.Stat(partialPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() >= download.Size {
+		return nil, 0, nil
+	}
+	// A partial of another file with the same name must not be spliced on
+	if offerSize(partialPath) != download.Size {
+		return nil, 0, nil
+	}
+
+	msg, err := irc.ParseMessage(dccStr)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := d.resume(ctx, conn, msg.Nick(), download, info.Size())
+
+	file, err := os.OpenFile(partialPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Start over if the sender didn't accept
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, offset, nil
+}
+
+// listen opens a listener for a passive offer and tells the sender where to
+// connect.
+func (d *Downloader) listen(conn *irc.Conn, dccStr string, download *dcc.Download) (net.Listener, error) {
+	msg, err := irc.ParseMessage(dccStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(d.Passive.ExternalIP)
+	if ip == nil {
+		local, ok := conn.LocalAddr().(*net.TCPAddr)
+		if !ok {
+			return nil, ErrPassiveOffer
+		}
+		ip = local.IP
+	}
+
+	listener, err := d.Passive.Listen()
+	if err != nil {
+		return nil, err
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	conn.SendCTCP(msg.Nick(), irc.CTCP{Command: irc.CTCPDCC, Params: dcc.PassiveReply(download, ip, port)})
+	return listener, nil
+}
+
+// resume asks nick to continue download from position and returns the
+// position the sender accepted, or 0 if it didn't answer in time.
+func (d *Downloader) resume(ctx context.Context, conn *irc.Conn, nick string, download *dcc.Download, position int64) int64 {
+	accepted := make(chan int64, 1)
+	d.mu.Lock()
+	if d.accepts == nil {
+		d.accepts = make(map[string]chan int64)
+	}
+	d.accepts[download.Port] = accepted
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.accepts, download.Port)
+		d.mu.Unlock()
+	}()
+
+	conn.SendCTCP(nick, irc.CTCP{Command: irc.CTCPDCC, Params: dcc.ResumeRequest(download, position)})
+
+	timeout := d.ResumeTimeout
+	if timeout <= 0 {
+		timeout = DefaultResumeTimeout
+	}
+
+	select {
+	case offset := <-accepted:
+		// Never trust an offset past what we already have
+		if offset < 0 || offset > position {
+			return 0
+		}
+		return offset
+	case <-time.After(timeout):
+		return 0
+	case <-ctx.Done():
+		return 0
+	}
+}
+
+// Accept handles DCCAccept events by continuing the transfer waiting on the
+// accepted port.
+func (d *Downloader) Accept(line string) {
+	accept, err := dcc.ParseAccept(line)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	accepted, ok := d.accepts[accept.Port]
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case accepted <- accept.Position:
+	default:
+	}
+}
+
+// DownloadExtractDCCString downloads the file offered by dccStr to baseDir
+// without resuming partial downloads.
+func DownloadExtractDCCString(baseDir, dccStr string, progress io.Writer, dialer proxy.Dialer) (string, error) {
+	return NewDownloader(dialer).Download(context.Background(), nil, nil, baseDir, dccStr, progress)
 }
 
 func renameTempFile(filePath string) string {
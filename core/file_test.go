@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/evan-buss/openbooks/dcc"
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/evan-buss/openbooks/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloaderResume(t *testing.T) {
+	content := []byte("The Great Gatsby, resumed after the connection dropped halfway.")
+
+	dccServer := &mock.DccServer{Port: ":6976", Reader: bytes.NewReader(content)}
+	ircServer := &mock.IrcServer{Port: ":6975", DCC: map[string]*mock.DccServer{"6976": dccServer}}
+	ready := make(chan struct{}, 2)
+	go dccServer.Start(ready)
+	go ircServer.Start(ready)
+	<-ready
+	<-ready
+
+	conn := irc.New("evan_28", "OpenBooks")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, Join(ctx, conn, "127.0.0.1:6975", false))
+	defer conn.Disconnect()
+
+	downloader := NewDownloader(nil)
+	downloader.ResumeTimeout = 5 * time.Second
+	go StartReader(ctx, conn, EventHandler{DCCAccept: downloader.Accept})
+
+	// An earlier attempt left the first part behind
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "great-gatsby.epub.temp")
+	require.NoError(t, os.WriteFile(partial, content[:20], 0644))
+	require.NoError(t, os.WriteFile(offerSizePath(partial), []byte(strconv.Itoa(len(content))), 0644))
+
+	offer := fmt.Sprintf(":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND great-gatsby.epub 2130706433 6976 %d\x01", len(content))
+	path, err := downloader.Download(ctx, conn, nil, dir, offer, nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "great-gatsby.epub"), path)
+	assert.NoFileExists(t, offerSizePath(partial))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func TestDownloaderPartialNotResumed(t *testing.T) {
+	download := &dcc.Download{Filename: "great-gatsby.epub", IP: "127.0.0.1", Port: "6976", Size: 64}
+	offer := ":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND great-gatsby.epub 2130706433 6976 64\x01"
+	// Never connected, resuming would fail
+	conn := irc.New("evan_28", "OpenBooks")
+
+	cases := []struct {
+		reason string
+		size   string
+		inUse  bool
+	}{
+		{"partial of an offer with another size", "128", false},
+		{"partial without a recorded size", "", false},
+		{"partial another transfer is writing", "64", true},
+	}
+
+	for _, c := range cases {
+		dir := t.TempDir()
+		partial := filepath.Join(dir, "great-gatsby.epub.temp")
+		require.NoError(t, os.WriteFile(partial, []byte("The Great Gatsby"), 0644))
+		if c.size != "" {
+			require.NoError(t, os.WriteFile(offerSizePath(partial), []byte(c.size), 0644))
+		}
+		if c.inUse {
+			require.True(t, claimPartial(partial))
+		}
+
+		file, path, offset, err := NewDownloader(nil).openTemp(context.Background(), conn, dir, offer, download)
+		require.NoError(t, err, c.reason)
+		file.Close()
+		releasePartial(path)
+		if c.inUse {
+			releasePartial(partial)
+		}
+
+		assert.Equal(t, filepath.Join(dir, "great-gatsby (1).epub.temp"), path, c.reason)
+		assert.Zero(t, offset, c.reason)
+		data, err := os.ReadFile(partial)
+		require.NoError(t, err)
+		assert.Equal(t, "The Great Gatsby", string(data), c.reason)
+	}
+}
+
+func TestDownloaderWithoutResume(t *testing.T) {
+	content := []byte("A complete file from a sender that never resumes.")
+
+	dccServer := &mock.DccServer{Port: ":6977", Reader: bytes.NewReader(content)}
+	ready := make(chan struct{}, 1)
+	go dccServer.Start(ready)
+	<-ready
+
+	// A finished download with the same name must not be overwritten
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "book.epub"), []byte("keep me"), 0644))
+
+	offer := fmt.Sprintf(":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND book.epub 2130706433 6977 %d\x01", len(content))
+	path, err := DownloadExtractDCCString(dir, offer, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "book (1).epub"), path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
+
+func TestDownloaderPassive(t *testing.T) {
+	content := []byte("Sent by a bot behind NAT that can't accept connections.")
+
+	dccServer := &mock.DccServer{Reader: bytes.NewReader(content)}
+	ircServer := &mock.IrcServer{Port: ":6978", Passive: map[string]*mock.DccServer{"177": dccServer}}
+	ready := make(chan struct{}, 1)
+	go ircServer.Start(ready)
+	<-ready
+
+	conn := irc.New("evan_28", "OpenBooks")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, Join(ctx, conn, "127.0.0.1:6978", false))
+	defer conn.Disconnect()
+	go StartReader(ctx, conn, EventHandler{})
+
+	downloader := NewDownloader(nil)
+	downloader.Passive.ExternalIP = "127.0.0.1"
+	downloader.Passive.Ports = "6979-6980"
+
+	dir := t.TempDir()
+	offer := fmt.Sprintf(":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND passive.epub 3232235777 0 %d 177\x01", len(content))
+	path, err := downloader.Download(ctx, conn, nil, dir, offer, nil)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	_, err = DownloadExtractDCCString(dir, offer, nil, nil)
+	assert.ErrorIs(t, err, ErrPassiveOffer)
+}
+
+func TestDownloaderIntegrity(t *testing.T) {
+	content := []byte("A book that doesn't match the hash in its search result.")
+
+	dccServer := &mock.DccServer{Port: ":6981", Reader: bytes.NewReader(content)}
+	ready := make(chan struct{}, 1)
+	go dccServer.Start(ready)
+	<-ready
+
+	dir := t.TempDir()
+	offer := fmt.Sprintf(":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND corrupt.epub 2130706433 6981 %d\x01", len(content))
+	req := &Request{Size: "0.1KB", Hash: "d41d8cd98f00b204e9800998ecf8427e"}
+
+	// The file is still saved so the user can decide what to do with it
+	path, err := NewDownloader(nil).Download(context.Background(), nil, req, dir, offer, nil)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	assert.Equal(t, filepath.Join(dir, "corrupt.epub"), path)
+	assert.FileExists(t, path)
+}
+
+func TestDownloaderPassiveQueued(t *testing.T) {
+	content := []byte("Only offered to connect once a transfer slot is free.")
+
+	dccServer := &mock.DccServer{Reader: bytes.NewReader(content)}
+	ircServer := &mock.IrcServer{Port: ":6982", Passive: map[string]*mock.DccServer{"178": dccServer}}
+	ready := make(chan struct{}, 1)
+	go ircServer.Start(ready)
+	<-ready
+
+	conn := irc.New("evan_28", "OpenBooks")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, Join(ctx, conn, "127.0.0.1:6982", false))
+	defer conn.Disconnect()
+	go StartReader(ctx, conn, EventHandler{})
+
+	downloader := NewDownloader(nil)
+	downloader.Passive.ExternalIP = "127.0.0.1"
+	downloader.Passive.Ports = "6983"
+	downloader.Transfers = dcc.NewManager(dcc.Limits{MaxConcurrent: 1})
+	require.NoError(t, downloader.Transfers.Acquire(ctx))
+
+	dir := t.TempDir()
+	offer := fmt.Sprintf(":DV8!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND queued.epub 3232235777 0 %d 178\x01", len(content))
+	done := make(chan error, 1)
+	go func() {
+		_, err := downloader.Download(ctx, conn, nil, dir, offer, nil)
+		done <- err
+	}()
+
+	// No listener is opened for the sender while the transfer is queued
+	require.Eventually(t, func() bool { return downloader.Transfers.Queued() == 1 }, time.Second, 10*time.Millisecond)
+	listener, err := net.Listen("tcp", "127.0.0.1:6983")
+	require.NoError(t, err)
+	listener.Close()
+
+	downloader.Transfers.Release()
+	require.NoError(t, <-done)
+	data, err := os.ReadFile(filepath.Join(dir, "queued.epub"))
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
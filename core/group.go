@@ -0,0 +1,83 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// Mirror is one server's copy of a book.
+type Mirror struct {
+	BookDetail
+	// Online is set when the server was in the channel's user list
+	Online bool `json:"online"`
+}
+
+// BookGroup is one logical book offered by one or more servers.
+type BookGroup struct {
+	Author string `json:"author"`
+	Title  string `json:"title"`
+	Format string `json:"format"`
+	// Mirrors are the copies of the book, most likely to work first
+	Mirrors []Mirror `json:"mirrors"`
+}
+
+// GroupBooks clusters search results that are the same book by their
+// normalized author, title and format. Groups keep the order in which their
+// first result appeared. online lists the servers currently in the channel,
+// which are ranked before the rest.
+func GroupBooks(books []BookDetail, online []string) []BookGroup {
+	isOnline := make(map[string]bool, len(online))
+	for _, server := range online {
+		isOnline[strings.ToLower(server)] = true
+	}
+
+	groups := make([]BookGroup, 0)
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, book := range books {
+		// The same line listed twice by one server is one mirror
+		if seen[book.Full] {
+			continue
+		}
+		seen[book.Full] = true
+
+		key := groupKey(book)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, BookGroup{})
+		}
+		groups[i].Mirrors = append(groups[i].Mirrors, Mirror{BookDetail: book, Online: isOnline[strings.ToLower(book.Server)]})
+	}
+
+	for i := range groups {
+		mirrors := groups[i].Mirrors
+		sort.SliceStable(mirrors, func(a, b int) bool {
+			return mirrorRank(mirrors[a]) > mirrorRank(mirrors[b])
+		})
+		best := mirrors[0]
+		groups[i].Author, groups[i].Title, groups[i].Format = best.Author, best.Title, best.Format
+	}
+	return groups
+}
+
+// mirrorRank prefers servers that are online, then results that advertise
+// enough to verify the download.
+func mirrorRank(mirror Mirror) int {
+	rank := 0
+	if mirror.Online {
+		rank += 4
+	}
+	if mirror.Hash != "" {
+		rank += 2
+	}
+	if mirror.Bytes > 0 {
+		rank++
+	}
+	return rank
+}
+
+func groupKey(book BookDetail) string {
+	return authorKey(book.Author) + "\x00" + titleKey(book.Title) + "\x00" + strings.ToLower(book.Format)
+}
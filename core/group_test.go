@@ -0,0 +1,70 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupBooks(t *testing.T) {
+	books, _ := ParseSearchV2(strings.NewReader(sampleData))
+	groups := GroupBooks(books, []string{"oatmeal", "peapod"})
+
+	var churchwell *BookGroup
+	total := 0
+	for i, group := range groups {
+		total += len(group.Mirrors)
+		if strings.HasPrefix(group.Title, "Careless People") {
+			require.Nil(t, churchwell, "Careless People should be a single group")
+			churchwell = &groups[i]
+		}
+	}
+	require.NotNil(t, churchwell)
+	assert.Less(t, len(groups), len(books))
+
+	// Online servers first, then results that can be verified
+	servers := make([]string, 0, len(churchwell.Mirrors))
+	for _, mirror := range churchwell.Mirrors {
+		servers = append(servers, mirror.Server)
+	}
+	assert.Equal(t, []string{"Oatmeal", "peapod", "Ook", "JimBob420", "Horla"}, servers)
+	assert.True(t, churchwell.Mirrors[0].Online)
+	assert.False(t, churchwell.Mirrors[2].Online)
+	assert.Equal(t, "Sarah Churchwell", churchwell.Author)
+	assert.Equal(t, "epub", churchwell.Format)
+
+	// Duplicate lines from the same server are dropped
+	assert.Less(t, total, len(books))
+}
+
+func TestGroupBooksKey(t *testing.T) {
+	books := []BookDetail{
+		{Server: "DV8", Author: "F. Scott Fitzgerald", Title: "The Great Gatsby", Format: "epub", Full: "!DV8 F. Scott Fitzgerald - The Great Gatsby.epub"},
+		{Server: "Oatmeal", Author: "F Scott  Fitzgerald", Title: "the great gatsby", Format: "epub", Full: "!Oatmeal F Scott  Fitzgerald - the great gatsby.epub"},
+		{Server: "Oatmeal", Author: "F Scott Fitzgerald", Title: "The Great Gatsby", Format: "mobi", Full: "!Oatmeal F Scott Fitzgerald - The Great Gatsby.mobi"},
+	}
+
+	groups := GroupBooks(books, nil)
+	require.Len(t, groups, 2)
+	assert.Len(t, groups[0].Mirrors, 2)
+	assert.Equal(t, "mobi", groups[1].Format)
+}
+
+func TestGroupBooksLastFirst(t *testing.T) {
+	var books []BookDetail
+	for _, line := range []string{
+		"!Oatmeal Orwell, George - Animal Farm.epub",
+		"!peapod George Orwell - Animal Farm.epub",
+	} {
+		book, err := parseLineV2(line)
+		require.NoError(t, err)
+		books = append(books, book)
+	}
+
+	groups := GroupBooks(books, nil)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "George Orwell", groups[0].Author)
+	assert.Equal(t, "Animal Farm", groups[0].Title)
+}
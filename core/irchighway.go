@@ -1,25 +1,29 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/evan-buss/openbooks/irc"
 )
 
 // Specific irc.irchighway.net commands
 
-// Join connects to the irc.irchighway.net server and joins the #ebooks channel
-func Join(irc *irc.Conn, address string, enableTLS bool) error {
-	err := irc.Connect(address, enableTLS)
+// Join connects to the irc.irchighway.net server and joins the #ebooks
+// channel. It returns once the server has confirmed the join, or when ctx is
+// cancelled.
+func Join(ctx context.Context, irc *irc.Conn, address string, enableTLS bool) error {
+	err := irc.Connect(ctx, address, enableTLS)
 	if err != nil {
 		return err
 	}
-	// Wait before joining the ebooks room
-	// Often you recieve a private message from the server
-	time.Sleep(time.Second * 2)
-	irc.JoinChannel("ebooks")
+
+	err = irc.Join(ctx, "ebooks")
+	if err != nil {
+		irc.Close()
+		return err
+	}
 	return nil
 }
 
@@ -33,12 +37,3 @@ func SearchBook(irc *irc.Conn, searchBot string, query string) {
 func DownloadBook(irc *irc.Conn, book string) {
 	irc.SendMessage(book)
 }
-
-// Send a CTCP Version response
-func SendVersionInfo(irc *irc.Conn, line string, version string) {
-	// Line format is like ":messager PRIVMSG #channel: message"
-	// we just want the messager without the colon
-	sender := strings.Split(line, " ")[0][1:]
-	// TODO: Figure out if there's an automated way to adjust this...
-	irc.SendNotice(sender, fmt.Sprintf("\x01%s\x01", version))
-}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// BookTags are the bracketed notes servers add to titles, like "(retail)",
+// "(v5.0)" or "[Raintree 01]".
+type BookTags struct {
+	Retail bool `json:"retail,omitempty"`
+	// Version is the release version without the "v", like "5.0"
+	Version string `json:"version,omitempty"`
+	// Series and Number come from tags like "[Raintree 01]"
+	Series string `json:"series,omitempty"`
+	Number string `json:"number,omitempty"`
+	Year   string `json:"year,omitempty"`
+	// Other holds the tags that aren't recognized, like "epub"
+	Other []string `json:"other,omitempty"`
+}
+
+var (
+	tagRegex     = regexp.MustCompile(`\s*[(\[]([^()\[\]]*)[)\]]`)
+	versionRegex = regexp.MustCompile(`(?i)^v(\d+(?:\.\d+)*)$`)
+	yearRegex    = regexp.MustCompile(`^(1[5-9]|20)\d\d$`)
+	seriesRegex  = regexp.MustCompile(`^(\D*\S)\s+#?(\d+(?:\.\d+)?)$`)
+)
+
+// ExtractTags removes the bracketed tags from a title and returns them
+// sorted into fields.
+func ExtractTags(title string) (string, BookTags) {
+	var tags BookTags
+	for _, match := range tagRegex.FindAllStringSubmatch(title, -1) {
+		tag := strings.TrimSpace(match[1])
+		switch {
+		case tag == "":
+		case strings.EqualFold(tag, "retail"):
+			tags.Retail = true
+		case versionRegex.MatchString(tag):
+			tags.Version = versionRegex.FindStringSubmatch(tag)[1]
+		case yearRegex.MatchString(tag):
+			tags.Year = tag
+		case seriesRegex.MatchString(tag):
+			series := seriesRegex.FindStringSubmatch(tag)
+			tags.Series, tags.Number = series[1], series[2]
+		default:
+			tags.Other = append(tags.Other, tag)
+		}
+	}
+
+	// Tags between dashes leave "-  -" behind, like "Linda Howard -[Raintree 01]- Inferno"
+	title = tagRegex.ReplaceAllString(title, " ")
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.ReplaceAll(title, "- -", "-")
+	return strings.Trim(title, " -"), tags
+}
+
+// mergeTags adds the tags found in another part of a result line to tags.
+func mergeTags(tags, more BookTags) BookTags {
+	tags.Retail = tags.Retail || more.Retail
+	if tags.Version == "" {
+		tags.Version = more.Version
+	}
+	if tags.Series == "" {
+		tags.Series, tags.Number = more.Series, more.Number
+	}
+	if tags.Year == "" {
+		tags.Year = more.Year
+	}
+	tags.Other = append(tags.Other, more.Other...)
+	return tags
+}
+
+// nameSuffixes come after a comma without the name being "Last, First".
+var nameSuffixes = map[string]bool{"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true}
+
+// nameParticles are lowercase words that can appear in a name.
+var nameParticles = map[string]bool{"de": true, "da": true, "del": true, "der": true, "di": true, "du": true, "la": true, "le": true, "van": true, "von": true}
+
+// CanonicalAuthor rewrites an author name in one form, so "Fitzgerald, F
+// Scott", "F.Scott Fitzgerald" and "F. Scott  Fitzgerald" all become
+// "F. Scott Fitzgerald". Diacritics are kept; normalizeKey drops them when
+// names are compared.
+func CanonicalAuthor(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+
+	// "Last, First" but not "First Last, Jr." or lists of several authors
+	// like "Douglas Preston, Lincoln Child"
+	if last, first, found := strings.Cut(name, ", "); found && !strings.Contains(first, ",") &&
+		!strings.Contains(name, "&") && !strings.Contains(strings.ToLower(name), " and ") &&
+		!nameSuffixes[strings.ToLower(strings.Trim(first, "."))] &&
+		isSurname(last) && len(strings.Fields(first)) <= 3 {
+		name = first + " " + last
+	}
+
+	// Initials get a dot and a space each, "J.R.R." becomes "J. R. R.". A
+	// single letter at the end is a name, like "Malcolm X".
+	words := strings.Fields(strings.ReplaceAll(name, ".", ". "))
+	for i, word := range words {
+		runes := []rune(word)
+		if len(runes) == 1 && unicode.IsUpper(runes[0]) && i < len(words)-1 {
+			words[i] = word + "."
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// isSurname reports whether text is a single surname, optionally after
+// particles like "van".
+func isSurname(text string) bool {
+	words := strings.Fields(text)
+	for len(words) > 1 && nameParticles[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+	return len(words) == 1
+}
+
+// looksLikeName guesses whether text is a person's name: a few capitalized
+// words without digits, brackets or a leading article.
+func looksLikeName(text string) bool {
+	words := strings.Fields(text)
+	if len(words) < 2 || len(words) > 4 {
+		return false
+	}
+	switch strings.ToLower(words[0]) {
+	case "the", "a", "an":
+		return false
+	}
+
+	for _, word := range words {
+		if nameParticles[word] {
+			continue
+		}
+		for i, r := range word {
+			if i == 0 && !unicode.IsUpper(r) {
+				return false
+			}
+			if !unicode.IsLetter(r) && !strings.ContainsRune(".'-", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// looksLikeTitle guesses whether text clearly isn't a person's name: it
+// starts with an article, has digits or brackets, or has lowercase words
+// other than name particles. Co-authors like "Preston & Child" are names.
+func looksLikeTitle(text string) bool {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return false
+	}
+	switch strings.ToLower(words[0]) {
+	case "the", "a", "an":
+		return true
+	}
+	if strings.ContainsAny(text, "()[]0123456789") {
+		return true
+	}
+
+	for _, word := range words {
+		if r := []rune(word)[0]; unicode.IsLower(r) && !nameParticles[word] && word != "and" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeBook fixes up a parsed result: swapped author and title are put
+// back, tags are moved out of the title and the author is made canonical.
+func normalizeBook(book *BookDetail) {
+	author, authorTags := ExtractTags(book.Author)
+	title, titleTags := ExtractTags(book.Title)
+
+	// Some servers list "Title - Author". Only swap when the author clearly
+	// isn't a name, two word titles like "Animal Farm" look like one.
+	if looksLikeName(title) && looksLikeTitle(book.Author) {
+		author, title = title, author
+	}
+
+	book.Author = CanonicalAuthor(author)
+	book.Title = title
+	book.Tags = mergeTags(titleTags, authorTags)
+}
+
+// foldDiacritics removes accents, so "Brontë" becomes "Bronte".
+func foldDiacritics(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// normalizeKey lowercases text, removes diacritics and reduces punctuation
+// and runs of spaces to single spaces, so "F. Scott Fitzgerald" and
+// "F Scott  Fitzgerald" match.
+func normalizeKey(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(foldDiacritics(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// authorKey compares author names regardless of their form.
+func authorKey(author string) string {
+	return normalizeKey(CanonicalAuthor(author))
+}
+
+// titleKey compares titles, ignoring tags and a trailing article like
+// "Great Gatsby, The".
+func titleKey(title string) string {
+	title, _ = ExtractTags(title)
+	if i := strings.LastIndex(title, ", "); i != -1 {
+		switch article := strings.ToLower(strings.TrimSpace(title[i+2:])); article {
+		case "the", "a", "an":
+			title = article + " " + title[:i]
+		}
+	}
+	return normalizeKey(title)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalAuthor(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"F. Scott Fitzgerald", "F. Scott Fitzgerald"},
+		{"F Scott  Fitzgerald", "F. Scott Fitzgerald"},
+		{"Fitzgerald, F. Scott", "F. Scott Fitzgerald"},
+		{"Fitzgerald, F Scott", "F. Scott Fitzgerald"},
+		{"Tolkien, J.R.R.", "J. R. R. Tolkien"},
+		{"Brontë, Charlotte", "Charlotte Brontë"},
+		{"Martin Luther King, Jr.", "Martin Luther King, Jr."},
+		{"Douglas Preston, Lincoln Child", "Douglas Preston, Lincoln Child"},
+		{"Malcolm X", "Malcolm X"},
+		{"X, Malcolm", "Malcolm X"},
+		{"van Gogh, Vincent", "Vincent van Gogh"},
+		{"Preston, Douglas & Child, Lincoln", "Preston, Douglas & Child, Lincoln"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, CanonicalAuthor(c.name), c.name)
+	}
+}
+
+func TestAuthorKey(t *testing.T) {
+	key := authorKey("F. Scott Fitzgerald")
+	assert.Equal(t, key, authorKey("Fitzgerald, F Scott"))
+	assert.Equal(t, key, authorKey("F.Scott Fitzgerald"))
+	assert.Equal(t, authorKey("Charlotte Bronte"), authorKey("Brontë, Charlotte"))
+	assert.Equal(t, titleKey("The Great Gatsby (retail)"), titleKey("Great Gatsby, The"))
+}
+
+func TestExtractTags(t *testing.T) {
+	cases := []struct {
+		title    string
+		expected string
+		tags     BookTags
+	}{
+		{"The Great Gatsby (retail) (epub)", "The Great Gatsby", BookTags{Retail: true, Other: []string{"epub"}}},
+		{"Inferno (v5.0) [Inferno 01]", "Inferno", BookTags{Version: "5.0", Series: "Inferno", Number: "01"}},
+		{"-[Raintree 01]- Inferno", "Inferno", BookTags{Series: "Raintree", Number: "01"}},
+		{"The Great Gatsby (1925)", "The Great Gatsby", BookTags{Year: "1925"}},
+		{"The Great Gatsby", "The Great Gatsby", BookTags{}},
+	}
+
+	for _, c := range cases {
+		title, tags := ExtractTags(c.title)
+		assert.Equal(t, c.expected, title, c.title)
+		assert.Equal(t, c.tags, tags, c.title)
+	}
+}
+
+func TestNormalizeBookSwapped(t *testing.T) {
+	cases := []struct {
+		author string
+		title  string
+		swap   bool
+	}{
+		{"So we Read on -How the Great Gatsby came to be and why it Endures (2014)", "Maureen Corrigan", true},
+		{"The Great Gatsby", "F Scott Fitzgerald", true},
+		{"F Scott Fitzgerald", "The Great Gatsby", false},
+		{"Dan Brown", "Robert Langdon", false},
+		{"Orwell, George", "Animal Farm", false},
+		{"Preston, Douglas & Child, Lincoln", "Relic Hunters", false},
+		{"Call of Cthulhu", "Gatsby and the Great Race (monograph #0324)", false},
+	}
+
+	for _, c := range cases {
+		book := BookDetail{Author: c.author, Title: c.title}
+		normalizeBook(&book)
+		if c.swap {
+			assert.Equal(t, CanonicalAuthor(c.title), book.Author, c.title)
+		} else {
+			assert.Equal(t, CanonicalAuthor(c.author), book.Author, c.author)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/evan-buss/openbooks/dcc"
+	"github.com/evan-buss/openbooks/irc"
+)
+
+// DefaultMaxFileSize is the largest unrequested DCC offer accepted unless
+// configured otherwise.
+const DefaultMaxFileSize = 100 << 20
+
+var (
+	ErrUnsolicitedOffer = errors.New("offer doesn't match a request and isn't from a download server")
+	ErrOfferTooLarge    = errors.New("offered file is larger than the maximum file size")
+)
+
+// OfferError describes a DCC offer that was rejected.
+type OfferError struct {
+	Nick     string
+	Filename string
+	Size     int64
+	Err      error
+}
+
+func (e *OfferError) Error() string {
+	return fmt.Sprintf("rejected %q (%d bytes) from %s: %v", e.Filename, e.Size, e.Nick, e.Err)
+}
+
+func (e *OfferError) Unwrap() error {
+	return e.Err
+}
+
+// RejectHandlerFunc is called with the offer OfferPolicy turned down. req is
+// the request the offer matched, if any.
+type RejectHandlerFunc func(req *Request, text string, err error)
+
+// OfferPolicy decides which DCC offers are downloaded. Offers are accepted
+// when they answer an outstanding request, or come from an elevated user
+// (a download server) and are no larger than MaxSize.
+type OfferPolicy struct {
+	Requests *RequestTracker
+	// MaxSize is the largest file accepted in bytes from an elevated user
+	// that we didn't ask. Files the user requested are accepted at any size.
+	// Zero disables the limit.
+	MaxSize int64
+
+	mu       sync.RWMutex
+	elevated map[string]bool
+}
+
+func NewOfferPolicy(requests *RequestTracker, maxSize int64) *OfferPolicy {
+	return &OfferPolicy{Requests: requests, MaxSize: maxSize}
+}
+
+// SetElevatedUsers replaces the nicks trusted to send files we didn't
+// request. Usually IrcServers.ElevatedUsers.
+func (p *OfferPolicy) SetElevatedUsers(users []string) {
+	elevated := make(map[string]bool, len(users))
+	for _, user := range users {
+		elevated[strings.ToLower(user)] = true
+	}
+
+	p.mu.Lock()
+	p.elevated = elevated
+	p.mu.Unlock()
+}
+
+func (p *OfferPolicy) isElevated(nick string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.elevated[strings.ToLower(nick)]
+}
+
+// Check matches a raw DCC SEND line to its request and returns an
+// *OfferError if the offer should not be downloaded. A matched request is
+// returned either way so callers can report the rejection to whoever made
+// it.
+func (p *OfferPolicy) Check(line string) (*Request, error) {
+	msg, err := irc.ParseMessage(line)
+	if err != nil {
+		return nil, err
+	}
+	download, err := dcc.ParseString(line)
+	if err != nil {
+		return nil, err
+	}
+
+	req, ok := p.Requests.Match(msg.Nick(), download.Filename)
+	if !ok {
+		req = nil
+	}
+
+	offerErr := &OfferError{Nick: msg.Nick(), Filename: download.Filename, Size: download.Size}
+	switch {
+	case req == nil && !p.isElevated(msg.Nick()):
+		offerErr.Err = ErrUnsolicitedOffer
+	case req == nil && p.MaxSize > 0 && download.Size > p.MaxSize:
+		offerErr.Err = ErrOfferTooLarge
+	default:
+		return req, nil
+	}
+	return req, offerErr
+}
+
+// Filter wraps handler so it only sees offers the policy accepts. Rejected
+// offers go to rejected instead.
+func (p *OfferPolicy) Filter(handler OfferHandlerFunc, rejected RejectHandlerFunc) HandlerFunc {
+	return func(text string) {
+		req, err := p.Check(text)
+		if err != nil {
+			rejected(req, text, err)
+			return
+		}
+		handler(req, text)
+	}
+}
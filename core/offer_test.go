@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func offerLine(nick, filename string, size int) string {
+	return fmt.Sprintf(":%s!%s@ihw PRIVMSG evan_bot :\x01DCC SEND %s 2130706433 6669 %d\x01", nick, nick, filename, size)
+}
+
+func TestOfferPolicy(t *testing.T) {
+	policy := NewOfferPolicy(NewRequestTracker(), 1000)
+	policy.SetElevatedUsers([]string{"Horla"})
+	dune := policy.Requests.TrackDownload("!DV8 Frank Herbert - Dune.epub")
+	gatsby := policy.Requests.TrackDownload("!DV8 F. Scott Fitzgerald - The Great Gatsby.epub")
+
+	cases := []struct {
+		name string
+		line string
+		id   string
+		err  error
+	}{
+		{"requested", offerLine("DV8", "Frank_Herbert_-_Dune.epub", 1000), dune, nil},
+		{"unsolicited", offerLine("stranger", "virus.exe", 10), "", ErrUnsolicitedOffer},
+		{"elevated", offerLine("horla", "Moby Dick.epub", 10), "", nil},
+		{"elevated too large", offerLine("Horla", "Moby Dick.epub", 1001), "", ErrOfferTooLarge},
+		// The user asked for it, however big it is
+		{"requested large", offerLine("DV8", "The Great Gatsby.epub", 5000), gatsby, nil},
+	}
+
+	for _, c := range cases {
+		req, err := policy.Check(c.line)
+		if c.err == nil {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.ErrorIs(t, err, c.err, c.name)
+			var offerErr *OfferError
+			require.ErrorAs(t, err, &offerErr, c.name)
+		}
+
+		if c.id == "" {
+			assert.Nil(t, req, c.name)
+		} else if assert.NotNil(t, req, c.name) {
+			assert.Equal(t, c.id, req.ID, c.name)
+		}
+	}
+}
+
+func TestOfferPolicyNoLimit(t *testing.T) {
+	policy := NewOfferPolicy(NewRequestTracker(), 0)
+	policy.SetElevatedUsers([]string{"DV8"})
+
+	_, err := policy.Check(offerLine("DV8", "Huge.epub", 1<<30))
+	assert.NoError(t, err)
+}
+
+func TestOfferPolicyFilter(t *testing.T) {
+	policy := NewOfferPolicy(NewRequestTracker(), DefaultMaxFileSize)
+	id := policy.Requests.TrackSearch("search", "dune")
+
+	var accepted, rejected []string
+	handler := policy.Filter(
+		func(req *Request, text string) { accepted = append(accepted, req.ID) },
+		func(_ *Request, text string, err error) { rejected = append(rejected, err.Error()) },
+	)
+
+	handler(offerLine("Search", "Search_results_for_dune.txt.zip", 100))
+	handler(offerLine("Search", "Search_results_for_dune.txt.zip", 100))
+
+	assert.Equal(t, []string{id}, accepted)
+	require.Len(t, rejected, 1)
+	assert.Contains(t, rejected[0], "from Search")
+}
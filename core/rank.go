@@ -0,0 +1,93 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// Weights of the parts of a relevance score. Matching the query matters
+// most, the rest breaks ties between similar results.
+const (
+	queryWeight     = 10.0
+	onlineBoost     = 3.0
+	retailBoost     = 1.0
+	audiobookWeight = -4.0
+	nonEbookWeight  = -3.0
+)
+
+// formatScores rank ebook formats. Formats that aren't listed score zero.
+var formatScores = map[string]float64{
+	"epub": 2,
+	"azw3": 1,
+	"mobi": 1,
+	"pdf":  0.5,
+	// Archives without an ebook format in the name are usually audiobooks
+	"rar": -1,
+	"zip": -1,
+}
+
+// nonEbookFormats are returned by searches but aren't books.
+var nonEbookFormats = map[string]bool{"jpg": true, "htm": true, "html": true, "cdr": true}
+
+// ScoreBook rates how well book matches the words of query. Higher is better.
+// Results from online servers get a boost since they can be downloaded right
+// away.
+func ScoreBook(book BookDetail, query string, online bool) float64 {
+	words := strings.Fields(normalizeKey(book.Author + " " + book.Title))
+	have := make(map[string]bool, len(words))
+	for _, word := range words {
+		have[word] = true
+	}
+
+	score := 0.0
+	if terms := strings.Fields(normalizeKey(query)); len(terms) > 0 {
+		found := 0
+		for _, term := range terms {
+			if have[term] {
+				found++
+			}
+		}
+		score += queryWeight * float64(found) / float64(len(terms))
+	}
+
+	score += formatScores[strings.ToLower(book.Format)]
+	if nonEbookFormats[strings.ToLower(book.Format)] {
+		score += nonEbookWeight
+	}
+	if book.Tags.Retail || have["retail"] {
+		score += retailBoost
+	}
+	if have["audiobook"] || have["audio"] {
+		score += audiobookWeight
+	}
+	if online {
+		score += onlineBoost
+	}
+	return score
+}
+
+// RankBooks sorts books by relevance to query, best first. Results with the
+// same score keep their order. online lists the servers currently in the
+// channel.
+func RankBooks(books []BookDetail, query string, online []string) {
+	isOnline := make(map[string]bool, len(online))
+	for _, server := range online {
+		isOnline[strings.ToLower(server)] = true
+	}
+
+	type scored struct {
+		book  BookDetail
+		score float64
+	}
+	ranked := make([]scored, len(books))
+	for i, book := range books {
+		ranked[i] = scored{book, ScoreBook(book, query, isOnline[strings.ToLower(book.Server)])}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+	for i := range ranked {
+		books[i] = ranked[i].book
+	}
+}
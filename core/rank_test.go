@@ -0,0 +1,61 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankBooks(t *testing.T) {
+	books := []BookDetail{
+		{Server: "Ook", Author: "Sarah Churchwell", Title: "Careless People (audiobook)", Format: "rar"},
+		{Server: "Horla", Author: "Someone Else", Title: "Unrelated", Format: "epub"},
+		{Server: "Ook", Author: "Sarah Churchwell", Title: "Careless People cover", Format: "jpg"},
+		{Server: "Ook", Author: "Sarah Churchwell", Title: "Careless People", Format: "pdf"},
+		{Server: "Ook", Author: "Sarah Churchwell", Title: "Careless People", Format: "epub"},
+		{Server: "Oatmeal", Author: "Sarah Churchwell", Title: "Careless People", Format: "epub"},
+		{Server: "Ook", Author: "Sarah Churchwell", Title: "Careless People (retail)", Format: "epub"},
+	}
+
+	RankBooks(books, "churchwell careless people", []string{"oatmeal"})
+
+	order := make([]string, 0, len(books))
+	for _, book := range books {
+		order = append(order, book.Server+" "+book.Title+"."+book.Format)
+	}
+	assert.Equal(t, []string{
+		"Oatmeal Careless People.epub",
+		"Ook Careless People (retail).epub",
+		"Ook Careless People.epub",
+		"Ook Careless People.pdf",
+		"Ook Careless People cover.jpg",
+		"Ook Careless People (audiobook).rar",
+		"Horla Unrelated.epub",
+	}, order)
+}
+
+func TestRankBooksStable(t *testing.T) {
+	books, _ := ParseSearchV2(strings.NewReader(sampleData))
+	require.NotEmpty(t, books)
+
+	// Without a query or online servers, equal results keep the parser order
+	var epubs []BookDetail
+	for _, book := range books {
+		if book.Format == "epub" && !book.Tags.Retail {
+			epubs = append(epubs, book)
+		}
+	}
+	ranked := append([]BookDetail(nil), epubs...)
+	RankBooks(ranked, "", nil)
+	assert.Equal(t, epubs, ranked)
+}
+
+func TestScoreBook(t *testing.T) {
+	book := BookDetail{Server: "Ook", Author: "F. Scott Fitzgerald", Title: "The Great Gatsby", Format: "epub"}
+
+	assert.Greater(t, ScoreBook(book, "fitzgerald gatsby", false), ScoreBook(book, "fitzgerald paradise", false))
+	assert.Greater(t, ScoreBook(book, "Gatsby", true), ScoreBook(book, "Gatsby", false))
+	assert.Equal(t, ScoreBook(book, "F Scott Fitzgerald", false), ScoreBook(book, "f. scott FITZGERALD", false))
+}
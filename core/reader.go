@@ -1,8 +1,9 @@
 package core
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"io"
 	"log"
 	"strings"
 
@@ -22,81 +23,170 @@ const (
 	MatchesFound   = event(7)
 	ServerList     = event(8)
 	Ping           = event(9)
-	Version        = event(10)
+	// CTCPQuery is a standard CTCP query that CTCPResponder answers
+	CTCPQuery = event(10)
+
+	// Connection state changes reported by Session.Supervise
+	Disconnected    = event(11)
+	Reconnecting    = event(12)
+	Reconnected     = event(13)
+	ReconnectFailed = event(14)
+
+	// Results of SASL or NickServ authentication
+	AuthSucceeded = event(15)
+	AuthFailed    = event(16)
+
+	// UnknownCTCP is a CTCP query OpenBooks doesn't answer
+	UnknownCTCP = event(17)
+
+	// DCCAccept is a sender agreeing to resume a DCC transfer
+	DCCAccept = event(18)
 )
 
-// Unique identifiers found in the message for various different events.
+// Unique identifiers found in the message text for various different events.
 const (
-	pingMessage            = "PING"
-	sendMessage            = "DCC SEND"
-	noticeMessage          = "NOTICE"
+	sendMessage            = "SEND"
+	secureSendMessage      = "SSEND"
+	acceptMessage          = "ACCEPT"
 	noResults              = "Sorry"
 	serverUnavailable      = "try another server"
 	searchAccepted         = "has been accepted"
 	searchResultIdentifier = "_results_for"
 	numMatches             = "matches"
-	beginUserList          = "353"
-	endUserList            = "366"
-	versionInquiry         = "\x01VERSION\x01"
+	nickServ               = "NickServ"
+)
+
+// Replies from NickServ after an IDENTIFY attempt
+var (
+	nickServAccepted = []string{"Password accepted", "You are now identified"}
+	nickServRejected = []string{"Password incorrect", "Invalid password", "isn't registered", "is not a registered"}
 )
 
 type HandlerFunc func(text string)
 type EventHandler map[event]HandlerFunc
 
-func StartReader(ctx context.Context, irc *irc.Conn, handler EventHandler) {
+// StartReader reads messages from the IRC connection and invokes the matching
+// event handlers. It returns nil once ctx is cancelled, otherwise the error
+// (io.EOF for a closed connection) that stopped the reader.
+func StartReader(ctx context.Context, conn *irc.Conn, handler EventHandler) error {
 	var users strings.Builder
-	scanner := bufio.NewScanner(irc)
-
-	for scanner.Scan() {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			text := scanner.Text()
-			if err := scanner.Err(); err != nil {
+
+	for {
+		msg, err := conn.ReadMessage()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && conn.IsConnected() {
 				log.Println(err)
 			}
+			return err
+		}
 
-			// Send raw message if they want to recieve it (logging purposes)
-			if invoke, ok := handler[Message]; ok {
-				invoke(text)
-			}
+		// Send raw message if they want to recieve it (logging purposes)
+		if invoke, ok := handler[Message]; ok {
+			invoke(msg.Raw)
+		}
 
-			event := noOp
-			if strings.Contains(text, sendMessage) {
-				if strings.Contains(text, searchResultIdentifier) {
-					event = SearchResult
-				} else {
-					event = BookResult
-				}
-			} else if strings.Contains(text, noticeMessage) {
-				if strings.Contains(text, noResults) {
-					event = NoResults
-				} else if strings.Contains(text, serverUnavailable) {
-					event = BadServer
-				} else if strings.Contains(text, searchAccepted) {
-					event = SearchAccepted
-				} else if strings.Contains(text, numMatches) {
-					start := strings.LastIndex(text, "returned") + 9
-					end := strings.LastIndex(text, "matches") - 1
-					text = text[start:end]
-					event = MatchesFound
-				}
-			} else if strings.Contains(text, beginUserList) {
-				users.WriteString(text)
-			} else if strings.Contains(text, endUserList) {
-				event = ServerList
-				text = users.String()
-				users.Reset()
-			} else if strings.Contains(text, pingMessage) {
-				event = Ping
-			} else if strings.Contains(text, versionInquiry) {
-				event = Version
-			}
+		event, text := classify(msg, &users)
+		if invoke, ok := handler[event]; ok {
+			go invoke(text)
+		}
+	}
+}
 
-			if invoke, ok := handler[event]; ok {
-				go invoke(text)
+// classify determines which event a message represents and the text that
+// should be passed to the event's handler.
+func classify(msg *irc.Message, users *strings.Builder) (event, string) {
+	switch msg.Command {
+	case irc.CmdPing:
+		return Ping, msg.Trailing()
+	case irc.CmdPrivmsg:
+		if msg.Prefix.IsServer() {
+			return noOp, msg.Raw
+		}
+		if ctcp, ok := msg.CTCP(); ok {
+			return classifyCTCP(ctcp, msg)
+		}
+	case irc.CmdNotice:
+		// Server notices (connection info, MOTD, etc.) are never search
+		// replies, and neither are CTCP replies.
+		if msg.Prefix.Name == "" || msg.Prefix.IsServer() {
+			return noOp, msg.Raw
+		}
+		if _, ok := msg.CTCP(); ok {
+			return noOp, msg.Raw
+		}
+		text := msg.Trailing()
+		if strings.EqualFold(msg.Nick(), nickServ) {
+			if containsAny(text, nickServAccepted) {
+				return AuthSucceeded, text
+			} else if containsAny(text, nickServRejected) {
+				return AuthFailed, text
 			}
+			return noOp, msg.Raw
+		}
+		if strings.Contains(text, noResults) {
+			return NoResults, msg.Raw
+		} else if strings.Contains(text, serverUnavailable) {
+			return BadServer, msg.Raw
+		} else if strings.Contains(text, searchAccepted) {
+			return SearchAccepted, msg.Raw
+		} else if strings.Contains(text, numMatches) {
+			return MatchesFound, parseMatchCount(text)
+		}
+	case irc.RplSaslSuccess:
+		return AuthSucceeded, msg.Trailing()
+	case irc.ErrNickLocked, irc.ErrSaslFail, irc.ErrSaslTooLong, irc.ErrSaslAborted:
+		return AuthFailed, msg.Trailing()
+	case irc.RplNamReply:
+		users.WriteString(msg.Trailing())
+		users.WriteString(" ")
+	case irc.RplEndOfNames:
+		text := users.String()
+		users.Reset()
+		return ServerList, text
+	}
+
+	return noOp, msg.Raw
+}
+
+// classifyCTCP sorts CTCP queries into DCC offers, DCC resume replies,
+// queries we answer and unknown queries.
+func classifyCTCP(ctcp irc.CTCP, msg *irc.Message) (event, string) {
+	switch {
+	case ctcp.Command == irc.CTCPDCC && (strings.HasPrefix(ctcp.Params, sendMessage) || strings.HasPrefix(ctcp.Params, secureSendMessage)):
+		if strings.Contains(ctcp.Params, searchResultIdentifier) {
+			return SearchResult, msg.Raw
+		}
+		return BookResult, msg.Raw
+	case ctcp.Command == irc.CTCPDCC && strings.HasPrefix(ctcp.Params, acceptMessage):
+		return DCCAccept, msg.Raw
+	case ctcp.Command == irc.CTCPAction:
+		return noOp, msg.Raw
+	case isCTCPQuery(ctcp.Command):
+		return CTCPQuery, msg.Raw
+	default:
+		return UnknownCTCP, msg.Raw
+	}
+}
+
+// parseMatchCount extracts the number of matches from a search bot notice
+// like "Your search for ... returned 27 matches".
+func parseMatchCount(text string) string {
+	start := strings.LastIndex(text, "returned")
+	end := strings.LastIndex(text, numMatches)
+	if start == -1 || end < start+len("returned") {
+		return text
+	}
+	return strings.TrimSpace(text[start+len("returned") : end])
+}
+
+func containsAny(text string, substrings []string) bool {
+	for _, substr := range substrings {
+		if strings.Contains(text, substr) {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		line  string
+		event event
+		text  string
+	}{
+		{"PING :irc.irchighway.net", Ping, "irc.irchighway.net"},
+		{":reader!~reader@ihw-9k2 PRIVMSG #ebooks :PING me when it returned 27 matches", noOp, ""},
+		{":reader!~reader@ihw-9k2 PRIVMSG #ebooks :Sorry, does anyone have a DCC SEND guide?", noOp, ""},
+		{":irc.irchighway.net NOTICE evan_bot :*** Sorry, you are connecting too fast", noOp, ""},
+		{":Search!Search@ihw-4q5 PRIVMSG evan_bot :\x01DCC SEND SearchBot_results_for__the_stand.txt.zip 2907707975 4342 1116\x01", SearchResult, ""},
+		{":Oatmeal!Oatmeal@ihw-1x2 PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub 2907707975 4343 358887\x01", BookResult, ""},
+		{":Oatmeal!Oatmeal@ihw-1x2 PRIVMSG evan_bot :\x01DCC SSEND great-gatsby.epub 2907707975 4343 358887\x01", BookResult, ""},
+		{":Oatmeal!Oatmeal@ihw-1x2 PRIVMSG evan_bot :\x01DCC ACCEPT file.ext 4343 1000\x01", DCCAccept, ""},
+		{`:Search!Search@ihw-4q5 NOTICE evan_bot :Sorry, your search for "zzzz" returned no matches.`, NoResults, ""},
+		{":Oatmeal!Oatmeal@ihw-1x2 NOTICE evan_bot :That server is offline, try another server", BadServer, ""},
+		{`:Search!Search@ihw-4q5 NOTICE evan_bot :Your search for "gatsby" has been accepted. Searching...`, SearchAccepted, ""},
+		{`:Search!Search@ihw-4q5 NOTICE evan_bot :Your search for "gatsby" returned 27 matches`, MatchesFound, "27"},
+		{":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01VERSION\x01", CTCPQuery, ""},
+		{":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01PING 1699999999\x01", CTCPQuery, ""},
+		{":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01time", CTCPQuery, ""},
+		{":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01USERINFO\x01", UnknownCTCP, ""},
+		{":mock!mock@ihw-1x2 PRIVMSG #ebooks :\x01ACTION waves\x01", noOp, ""},
+		{":reader!~reader@ihw-9k2 PRIVMSG #ebooks :what does \x01VERSION\x01 do?", noOp, ""},
+		{":mock!mock@ihw-1x2 NOTICE evan_bot :\x01VERSION mIRC v7.71\x01", noOp, ""},
+		{":irc.irchighway.net 903 evan_bot :SASL authentication successful", AuthSucceeded, "SASL authentication successful"},
+		{":irc.irchighway.net 904 evan_bot :SASL authentication failed", AuthFailed, "SASL authentication failed"},
+		{":NickServ!services@services.irchighway.net NOTICE evan_bot :Password accepted - you are now recognized.", AuthSucceeded, ""},
+		{":NickServ!services@services.irchighway.net NOTICE evan_bot :Password incorrect.", AuthFailed, ""},
+		{":NickServ!services@services.irchighway.net NOTICE evan_bot :Sorry, this nick is registered.", noOp, ""},
+	}
+
+	for _, c := range cases {
+		msg, err := irc.ParseMessage(c.line)
+		require.NoError(t, err)
+
+		var users strings.Builder
+		event, text := classify(msg, &users)
+		assert.Equal(t, c.event, event, c.line)
+		if c.text != "" {
+			assert.Equal(t, c.text, text, c.line)
+		}
+	}
+}
+
+func TestClassifyServerList(t *testing.T) {
+	var users strings.Builder
+	lines := []string{
+		":irc.irchighway.net 353 evan_bot = #ebooks :evan_bot ~DV8 +Horla",
+		":irc.irchighway.net 353 evan_bot = #ebooks :@Oatmeal reader",
+	}
+	for _, line := range lines {
+		msg, err := irc.ParseMessage(line)
+		require.NoError(t, err)
+		event, _ := classify(msg, &users)
+		assert.Equal(t, noOp, event)
+	}
+
+	msg, err := irc.ParseMessage(":irc.irchighway.net 366 evan_bot #ebooks :End of /NAMES list.")
+	require.NoError(t, err)
+	event, text := classify(msg, &users)
+	assert.Equal(t, ServerList, event)
+
+	servers := ParseServers(text)
+	assert.Equal(t, []string{"DV8", "Horla", "Oatmeal"}, servers.ElevatedUsers)
+	assert.Equal(t, []string{"evan_bot", "reader"}, servers.RegularUsers)
+}
@@ -38,8 +38,14 @@ type BookDetail struct {
 	Author string `json:"author"`
 	Title  string `json:"title"`
 	Format string `json:"format"`
-	Size   string `json:"size"`
-	Full   string `json:"full"`
+	// Size is the advertised size in a canonical notation like "394.7 KiB"
+	Size string `json:"size"`
+	// Bytes is Size converted to bytes. Zero when unknown.
+	Bytes int64  `json:"bytes"`
+	Hash  string `json:"hash"`
+	// Tags were taken out of the title, like "(retail)"
+	Tags BookTags `json:"tags"`
+	Full string   `json:"full"`
 }
 
 type ParseError struct {
@@ -106,6 +112,7 @@ func parseLine(line string) (BookDetail, error) {
 
 	var book BookDetail
 	book.Full = line[:strings.Index(line, " ::INFO:: ")]
+	size, hash, _ := parseInfo(line)
 	var tmp int
 
 	// Get Server
@@ -149,12 +156,9 @@ func parseLine(line string) (BookDetail, error) {
 		return BookDetail{}, errors.New("could not parse size")
 	}
 
-	line = strings.TrimSpace(line)
-	splits := strings.Split(line, " ")
-
-	if len(splits) >= 2 {
-		book.Size = splits[1]
-	}
+	book.Size = CanonicalSize(size)
+	book.Bytes, _, _ = ParseSize(size)
+	book.Hash = hash
 
 	return book, nil
 }
@@ -238,19 +242,6 @@ func parseLineV2(line string) (BookDetail, error) {
 		return title, fileFormat, endIndex
 	}
 
-	getSize := func(line string) (string, int) {
-		const delimiter = " ::INFO:: "
-		infoIndex := strings.LastIndex(line, delimiter)
-
-		if infoIndex != -1 {
-			// Handle cases when there is additional info after the file size (ex ::HASH:: )
-			parts := strings.Split(line[infoIndex+len(delimiter):], " ")
-			return parts[0], infoIndex
-		}
-
-		return "N/A", len(line)
-	}
-
 	server, err := getServer(line)
 	if err != nil {
 		return BookDetail{}, err
@@ -266,14 +257,41 @@ func parseLineV2(line string) (BookDetail, error) {
 		return BookDetail{}, errors.New("unable to parse title")
 	}
 
-	size, endIndex := getSize(line)
+	size, hash, endIndex := parseInfo(line)
+	bytes, _, _ := ParseSize(size)
 
-	return BookDetail{
+	book := BookDetail{
 		Server: server,
 		Author: author,
 		Title:  title,
 		Format: format,
-		Size:   size,
+		Size:   CanonicalSize(size),
+		Bytes:  bytes,
+		Hash:   hash,
 		Full:   strings.TrimSpace(line[:endIndex]),
-	}, nil
+	}
+	normalizeBook(&book)
+	return book, nil
+}
+
+// parseInfo extracts the size and hash from the " ::INFO:: 5MB ::HASH:: ..."
+// block at the end of a result line. index is where the block starts, or
+// len(line) when there is none.
+func parseInfo(line string) (size, hash string, index int) {
+	const delimiter = " ::INFO:: "
+	index = strings.LastIndex(line, delimiter)
+	if index == -1 {
+		return "", "", len(line)
+	}
+
+	info := line[index+len(delimiter):]
+	if hashIndex := strings.Index(info, "::HASH::"); hashIndex != -1 {
+		if fields := strings.Fields(info[hashIndex+len("::HASH::"):]); len(fields) > 0 {
+			hash = fields[0]
+		}
+		info = info[:hashIndex]
+	}
+
+	// Sizes may contain a space, like "205.10 KiB"
+	return strings.TrimSpace(info), hash, index
 }
@@ -51,9 +51,11 @@ func TestSpecialCases(t *testing.T) {
 			BookDetail{
 				Server: "DV8",
 				Author: "F. Scott Fitzgerald",
-				Title:  "The Great Gatsby (Epub)",
+				Title:  "The Great Gatsby",
 				Format: "epub",
-				Size:   "394.7KB",
+				Size:   "394.7 KiB",
+				Bytes:  404173,
+				Tags:   BookTags{Other: []string{"Epub"}},
 				Full:   "!DV8 F. Scott Fitzgerald - The Great Gatsby (Epub).rar",
 			},
 		},
@@ -62,10 +64,11 @@ func TestSpecialCases(t *testing.T) {
 			"!Horla F Scott Fitzgerald - The Great Gatsby (retail) (epub).epub",
 			BookDetail{
 				Server: "Horla",
-				Author: "F Scott Fitzgerald",
-				Title:  "The Great Gatsby (retail) (epub)",
+				Author: "F. Scott Fitzgerald",
+				Title:  "The Great Gatsby",
 				Format: "epub",
 				Size:   "N/A",
+				Tags:   BookTags{Retail: true, Other: []string{"epub"}},
 				Full:   "!Horla F Scott Fitzgerald - The Great Gatsby (retail) (epub).epub",
 			},
 		},
@@ -74,13 +77,53 @@ func TestSpecialCases(t *testing.T) {
 			"!Ook So we Read on -How the Great Gatsby came to be and why it Endures (2014) - Maureen Corrigan.epub  ::INFO:: 5MB ::HASH:: dde55317998f25aa",
 			BookDetail{
 				Server: "Ook",
-				Author: "So we Read on -How the Great Gatsby came to be and why it Endures (2014)",
-				Title:  "Maureen Corrigan",
+				Author: "Maureen Corrigan",
+				Title:  "So we Read on -How the Great Gatsby came to be and why it Endures",
 				Format: "epub",
-				Size:   "5MB",
+				Size:   "5 MiB",
+				Bytes:  5242880,
+				Hash:   "dde55317998f25aa",
+				Tags:   BookTags{Year: "2014"},
 				Full:   "!Ook So we Read on -How the Great Gatsby came to be and why it Endures (2014) - Maureen Corrigan.epub",
 			},
 		},
+		{
+			"last, first author with a title that looks like a name",
+			"!Oatmeal Orwell, George - Animal Farm.epub",
+			BookDetail{
+				Server: "Oatmeal",
+				Author: "George Orwell",
+				Title:  "Animal Farm",
+				Format: "epub",
+				Size:   "N/A",
+				Full:   "!Oatmeal Orwell, George - Animal Farm.epub",
+			},
+		},
+		{
+			"last, first author with a two word title",
+			"!Oatmeal Brown, Dan - Digital Fortress.epub",
+			BookDetail{
+				Server: "Oatmeal",
+				Author: "Dan Brown",
+				Title:  "Digital Fortress",
+				Format: "epub",
+				Size:   "N/A",
+				Full:   "!Oatmeal Brown, Dan - Digital Fortress.epub",
+			},
+		},
+		{
+			"title first, author second",
+			"!peapod The Great Gatsby - F Scott Fitzgerald.mobi  ::INFO:: 246.10KB",
+			BookDetail{
+				Server: "peapod",
+				Author: "F. Scott Fitzgerald",
+				Title:  "The Great Gatsby",
+				Format: "mobi",
+				Size:   "246.10 KiB",
+				Bytes:  252006,
+				Full:   "!peapod The Great Gatsby - F Scott Fitzgerald.mobi",
+			},
+		},
 		{
 			"has a weird %some_text% prefix on the title",
 			"!FWServer %F77FE9FF1CCD% Michael Haag - Inferno Decoded - The Essential Companion To The Myths, Mysteries And Locations Of Dan Brown's Inferno.epub  ::INFO:: 8.00MB",
@@ -89,7 +132,8 @@ func TestSpecialCases(t *testing.T) {
 				Author: "Michael Haag",
 				Title:  "Inferno Decoded - The Essential Companion To The Myths, Mysteries And Locations Of Dan Brown's Inferno",
 				Format: "epub",
-				Size:   "8.00MB",
+				Size:   "8.00 MiB",
+				Bytes:  8388608,
 				Full:   "!FWServer %F77FE9FF1CCD% Michael Haag - Inferno Decoded - The Essential Companion To The Myths, Mysteries And Locations Of Dan Brown's Inferno.epub",
 			},
 		},
@@ -98,13 +142,42 @@ func TestSpecialCases(t *testing.T) {
 			"!FWServer %DE7B9E7F6F34% Brown, Dan - Robert Langdon 04 - Inferno - Audiobook.zip  ::INFO:: 445.09MB",
 			BookDetail{
 				Server: "FWServer",
-				Author: "Brown, Dan",
+				Author: "Dan Brown",
 				Title:  "Robert Langdon 04 - Inferno - Audiobook",
 				Format: "zip",
-				Size:   "445.09MB",
+				Size:   "445.09 MiB",
+				Bytes:  466710692,
 				Full:   "!FWServer %DE7B9E7F6F34% Brown, Dan - Robert Langdon 04 - Inferno - Audiobook.zip",
 			},
 		},
+		{
+			"size with a space and binary unit",
+			"!phoomphy Fitzgerald, F. Scott - The Great Gatsby (1925).epub     ::INFO:: 205.10 KiB",
+			BookDetail{
+				Server: "phoomphy",
+				Author: "F. Scott Fitzgerald",
+				Title:  "The Great Gatsby",
+				Format: "epub",
+				Size:   "205.10 KiB",
+				Bytes:  210022,
+				Tags:   BookTags{Year: "1925"},
+				Full:   "!phoomphy Fitzgerald, F. Scott - The Great Gatsby (1925).epub",
+			},
+		},
+		{
+			"size with a decimal comma and hash",
+			"!Ook F Scott Fitzgerald - The Great Gatsby.epub  ::INFO:: 1,5MB ::HASH:: 8d860602f0f43789",
+			BookDetail{
+				Server: "Ook",
+				Author: "F. Scott Fitzgerald",
+				Title:  "The Great Gatsby",
+				Format: "epub",
+				Size:   "1.5 MiB",
+				Bytes:  1572864,
+				Hash:   "8d860602f0f43789",
+				Full:   "!Ook F Scott Fitzgerald - The Great Gatsby.epub",
+			},
+		},
 	}
 
 	for _, input := range cases {
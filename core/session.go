@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evan-buss/openbooks/irc"
+)
+
+// Backoff controls how long to wait between reconnect attempts. The delay
+// starts at Initial and doubles after every failed attempt up to Max.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	// MaxAttempts is the number of consecutive failed attempts before giving
+	// up. Zero means retry forever.
+	MaxAttempts int
+}
+
+// DefaultBackoff is used when a Session doesn't specify one.
+var DefaultBackoff = Backoff{
+	Initial:     2 * time.Second,
+	Max:         5 * time.Minute,
+	MaxAttempts: 10,
+}
+
+// Delay returns the wait time before the given (zero based) attempt. Up to
+// 20% of random jitter is added so clients don't reconnect in lockstep.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 0; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
+
+// Session describes the IRC servers to connect to and how a dropped
+// connection should be re-established. A Session may be shared by several
+// connections.
+type Session struct {
+	// Endpoints are tried in order until one accepts the connection.
+	Endpoints []Endpoint
+	Backoff   Backoff
+
+	mu sync.Mutex
+	// current is the index of the last endpoint that was joined
+	// successfully. It is tried first next time.
+	current int
+}
+
+// NewSession creates a Session for the given endpoints.
+func NewSession(endpoints []Endpoint, backoff Backoff) *Session {
+	return &Session{Endpoints: endpoints, Backoff: backoff}
+}
+
+// Current returns the endpoint that was last joined successfully, or the
+// first endpoint if none has been joined yet.
+func (s *Session) Current() Endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.Endpoints) == 0 {
+		return Endpoint{}
+	}
+	return s.Endpoints[s.current]
+}
+
+// Join connects conn to the session's servers and joins the #ebooks channel.
+// Starting with the last good endpoint, every endpoint is tried in order
+// until one succeeds.
+func (s *Session) Join(ctx context.Context, conn *irc.Conn) error {
+	s.mu.Lock()
+	start := s.current
+	s.mu.Unlock()
+
+	if len(s.Endpoints) == 0 {
+		return errors.New("no IRC server configured")
+	}
+
+	var failures []string
+	for n := 0; n < len(s.Endpoints); n++ {
+		index := (start + n) % len(s.Endpoints)
+		endpoint := s.Endpoints[index]
+
+		err := Join(ctx, conn, endpoint.Address, endpoint.TLS)
+		if err == nil {
+			s.mu.Lock()
+			s.current = index
+			s.mu.Unlock()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		// A single server doesn't need the extra context
+		if len(s.Endpoints) == 1 {
+			return err
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", endpoint.Address, err))
+	}
+
+	return fmt.Errorf("unable to connect to any IRC server (%s)", strings.Join(failures, "; "))
+}
+
+// Supervise reads messages from conn and dispatches them to handler until ctx
+// is cancelled or the connection is closed with Disconnect. When the
+// connection drops it reconnects with exponential backoff, registers again
+// and rejoins #ebooks. Connection state changes are reported with the
+// Disconnected, Reconnecting, Reconnected and ReconnectFailed events.
+func (s *Session) Supervise(ctx context.Context, conn *irc.Conn, handler EventHandler) {
+	// Cancelling ctx closes the connection so the socket and writer don't leak
+	defer func() {
+		if ctx.Err() != nil {
+			conn.Disconnect()
+		}
+	}()
+
+	for {
+		err := StartReader(ctx, conn, handler)
+		if ctx.Err() != nil || !conn.IsConnected() {
+			return
+		}
+		if err == nil {
+			err = io.EOF
+		}
+
+		notify(handler, Disconnected, err.Error())
+		if !s.reconnect(ctx, conn, handler) {
+			return
+		}
+	}
+}
+
+func (s *Session) reconnect(ctx context.Context, conn *irc.Conn, handler EventHandler) bool {
+	backoff := s.Backoff
+	if backoff.Initial <= 0 {
+		backoff = DefaultBackoff
+	}
+
+	var err error
+	for attempt := 0; backoff.MaxAttempts == 0 || attempt < backoff.MaxAttempts; attempt++ {
+		delay := backoff.Delay(attempt)
+		notify(handler, Reconnecting, delay.Round(time.Second).String())
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		// Disconnect was called while we were waiting
+		if !conn.IsConnected() {
+			return false
+		}
+
+		if err = s.Join(ctx, conn); err == nil {
+			notify(handler, Reconnected, s.Current().Address)
+			return true
+		}
+	}
+
+	notify(handler, ReconnectFailed, err.Error())
+	return false
+}
+
+// notify synchronously invokes the handler for state change events so they
+// are received in order.
+func notify(handler EventHandler, e event, text string) {
+	if invoke, ok := handler[e]; ok {
+		invoke(text)
+	}
+}
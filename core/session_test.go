@@ -0,0 +1,213 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 10 * time.Second}
+
+	cases := []struct {
+		attempt int
+		min     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+
+	for _, c := range cases {
+		delay := backoff.Delay(c.attempt)
+		assert.GreaterOrEqual(t, delay, c.min, "attempt %d", c.attempt)
+		assert.LessOrEqual(t, delay, c.min+c.min/5, "attempt %d", c.attempt)
+	}
+}
+
+// TestSuperviseReconnect drops the first connection and makes sure the
+// session registers and joins #ebooks again.
+func TestSuperviseReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	joined := make(chan struct{})
+	go func() {
+		// The first connection is closed right after registration
+		first, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(first, ":irc.test.net 001 evan_bot :Welcome\r\n")
+		first.Close()
+
+		second, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer second.Close()
+		fmt.Fprint(second, ":irc.test.net 001 evan_bot :Welcome\r\n")
+		scanner := bufio.NewScanner(second)
+		for scanner.Scan() {
+			if scanner.Text() == "JOIN #ebooks" {
+				fmt.Fprint(second, ":evan_bot!evan@irc.test.net JOIN #ebooks\r\n")
+				fmt.Fprint(second, ":irc.test.net 366 evan_bot #ebooks :End of /NAMES list.\r\n")
+				close(joined)
+			}
+		}
+	}()
+
+	session := NewSession(
+		[]Endpoint{{Address: listener.Addr().String()}},
+		Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond, MaxAttempts: 3},
+	)
+
+	conn := irc.New("evan_bot", "OpenBooks")
+	require.NoError(t, conn.Connect(context.Background(), listener.Addr().String(), false))
+
+	events := make(chan event, 10)
+	record := func(e event) HandlerFunc { return func(string) { events <- e } }
+	handler := EventHandler{
+		Disconnected: record(Disconnected),
+		Reconnecting: record(Reconnecting),
+		Reconnected:  record(Reconnected),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go session.Supervise(ctx, conn, handler)
+
+	for _, want := range []event{Disconnected, Reconnecting, Reconnected} {
+		select {
+		case got := <-events:
+			assert.Equal(t, want, got)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for event %d", want)
+		}
+	}
+
+	select {
+	case <-joined:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not rejoin #ebooks")
+	}
+
+	conn.Disconnect()
+}
+
+// joinServer accepts connections, welcomes the client and confirms every
+// JOIN.
+func joinServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, ":irc.test.net 001 evan_bot :Welcome\r\n")
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if scanner.Text() == "JOIN #ebooks" {
+						fmt.Fprint(conn, ":irc.test.net 366 evan_bot #ebooks :End of /NAMES list.\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// closedAddress returns an address nothing is listening on.
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestSessionFailover(t *testing.T) {
+	down := closedAddress(t)
+	up := joinServer(t)
+
+	session := NewSession([]Endpoint{{Address: down}, {Address: up}}, DefaultBackoff)
+	assert.Equal(t, down, session.Current().Address)
+
+	conn := irc.New("evan_bot", "OpenBooks")
+	require.NoError(t, session.Join(context.Background(), conn))
+	defer conn.Close()
+	assert.Equal(t, up, session.Current().Address)
+
+	// Every endpoint failing reports each of them
+	other := NewSession([]Endpoint{{Address: down}, {Address: closedAddress(t)}}, DefaultBackoff)
+	err := other.Join(context.Background(), irc.New("evan_bot", "OpenBooks"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), down)
+}
+
+func TestSuperviseCancel(t *testing.T) {
+	session := NewSession([]Endpoint{{Address: joinServer(t)}}, DefaultBackoff)
+	conn := irc.New("evan_bot", "OpenBooks")
+	require.NoError(t, session.Join(context.Background(), conn))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		session.Supervise(ctx, conn, EventHandler{})
+		close(done)
+	}()
+
+	// Cancelling closes the connection instead of leaking it
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervise did not return after cancel")
+	}
+	assert.False(t, conn.IsConnected())
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints([]string{
+		"irc.irchighway.net:6697",
+		"ircs://irc.irchighway.net",
+		"irc://irc.irchighway.net",
+		"irc://127.0.0.1:6668/",
+		"irc.example.net",
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []Endpoint{
+		{Address: "irc.irchighway.net:6697", TLS: true},
+		{Address: "irc.irchighway.net:6697", TLS: true},
+		{Address: "irc.irchighway.net:6667", TLS: false},
+		{Address: "127.0.0.1:6668", TLS: false},
+		{Address: "irc.example.net:6697", TLS: true},
+	}, endpoints)
+
+	endpoints, err = ParseEndpoints([]string{"irc.example.net"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Address: "irc.example.net:6667"}}, endpoints)
+
+	_, err = ParseEndpoints([]string{"https://irc.example.net"}, true)
+	assert.Error(t, err)
+	_, err = ParseEndpoints(nil, true)
+	assert.Error(t, err)
+}
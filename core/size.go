@@ -0,0 +1,85 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps the units used by search results to their canonical name
+// and size. Bots mean 1024 when they write KB.
+var sizeUnits = map[string]struct {
+	name  string
+	bytes float64
+}{
+	"B":   {"B", 1},
+	"KB":  {"KiB", 1 << 10},
+	"KIB": {"KiB", 1 << 10},
+	"MB":  {"MiB", 1 << 20},
+	"MIB": {"MiB", 1 << 20},
+	"GB":  {"GiB", 1 << 30},
+	"GIB": {"GiB", 1 << 30},
+}
+
+// splitSize separates an advertised size like "205,10 KiB" into its number,
+// using a decimal point, and unit.
+func splitSize(size string) (number, unit string, ok bool) {
+	size = strings.TrimSpace(size)
+	split := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != ','
+	})
+	if split <= 0 {
+		return "", "", false
+	}
+	number, unit = size[:split], strings.ToUpper(strings.TrimSpace(size[split:]))
+
+	// A comma is a thousands separator next to a decimal point and a decimal
+	// separator on its own
+	if strings.Contains(number, ".") {
+		number = strings.ReplaceAll(number, ",", "")
+	} else {
+		number = strings.Replace(number, ",", ".", 1)
+	}
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", "", false
+	}
+	if _, found := sizeUnits[unit]; !found {
+		return "", "", false
+	}
+	return number, unit, true
+}
+
+// ParseSize converts an advertised size like "394.7KB" to bytes. Bots round
+// sizes, so it also returns how far the real size may be from it.
+func ParseSize(size string) (bytes int64, tolerance int64, ok bool) {
+	number, unitName, ok := splitSize(size)
+	if !ok {
+		return 0, 0, false
+	}
+	unit := sizeUnits[unitName].bytes
+	value, _ := strconv.ParseFloat(number, 64)
+
+	// One step of the last digit shown, plus the difference between 1000 and
+	// 1024 based units for bots that mix them up
+	precision := 1.0
+	if dot := strings.Index(number, "."); dot != -1 {
+		precision = math.Pow(10, -float64(len(number)-dot-1))
+	}
+	bytes = int64(math.Round(value * unit))
+	tolerance = int64(math.Ceil(precision*unit + value*unit*0.05))
+	return bytes, tolerance, true
+}
+
+// CanonicalSize rewrites an advertised size in one notation, like
+// "394.7 KiB". The digits shown are kept so the precision isn't overstated.
+// Sizes that can't be parsed are returned trimmed, or "N/A" when empty.
+func CanonicalSize(size string) string {
+	number, unit, ok := splitSize(size)
+	if !ok {
+		if size = strings.TrimSpace(size); size != "" {
+			return size
+		}
+		return "N/A"
+	}
+	return number + " " + sizeUnits[unit].name
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/evan-buss/openbooks/dcc"
+	"github.com/evan-buss/openbooks/irc"
+	"github.com/google/uuid"
+)
+
+// DefaultRequestTTL is how long a request waits for its DCC offer before it
+// is forgotten.
+const DefaultRequestTTL = 10 * time.Minute
+
+// minSimilarity is the fraction of filename words that must be shared for
+// an offer to match a download request.
+const minSimilarity = 0.5
+
+type RequestKind int
+
+const (
+	SearchRequest RequestKind = iota
+	DownloadRequest
+)
+
+// Request is a search or download that is waiting for a DCC offer.
+type Request struct {
+	ID   string
+	Kind RequestKind
+	// Nick is the bot or file server expected to send the file
+	Nick string
+	// Filename is the requested file. Empty for searches.
+	Filename string
+	// Query is the search query or the full book line
+	Query string
+	// Size and Hash are advertised by the search result, if known
+	Size    string
+	Hash    string
+	Created time.Time
+}
+
+// OfferHandlerFunc handles a DCC offer. req is the request that caused the
+// offer, or nil if it doesn't match any outstanding request.
+type OfferHandlerFunc func(req *Request, text string)
+
+// RequestTracker records outstanding search and download requests and
+// matches incoming DCC offers back to them.
+type RequestTracker struct {
+	// TTL is how long requests wait for an offer. Defaults to DefaultRequestTTL.
+	TTL time.Duration
+
+	mu       sync.Mutex
+	requests []*Request
+	now      func() time.Time
+}
+
+func NewRequestTracker() *RequestTracker {
+	return &RequestTracker{TTL: DefaultRequestTTL, now: time.Now}
+}
+
+// TrackSearch records a search sent to searchBot and returns its ID.
+func (t *RequestTracker) TrackSearch(searchBot, query string) string {
+	return t.add(&Request{
+		Kind:  SearchRequest,
+		Nick:  strings.TrimPrefix(searchBot, "@"),
+		Query: query,
+	})
+}
+
+// TrackDownload records a book line like "!Server Author - Title.epub" and
+// returns its ID. The size and hash are kept for verification when the line
+// still has its ::INFO:: block.
+func (t *RequestTracker) TrackDownload(book string) string {
+	nick, filename := splitBookLine(book)
+	size, hash, _ := parseInfo(book)
+	return t.add(&Request{
+		Kind:     DownloadRequest,
+		Nick:     nick,
+		Filename: filename,
+		Query:    book,
+		Size:     size,
+		Hash:     hash,
+	})
+}
+
+// TrackBook records a download of a parsed search result and returns its ID.
+func (t *RequestTracker) TrackBook(book BookDetail) string {
+	nick, filename := splitBookLine(book.Full)
+	return t.add(&Request{
+		Kind:     DownloadRequest,
+		Nick:     nick,
+		Filename: filename,
+		Query:    book.Full,
+		Size:     book.Size,
+		Hash:     book.Hash,
+	})
+}
+
+func (t *RequestTracker) add(req *Request) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	req.ID = uuid.New().String()
+	req.Created = t.now()
+	t.prune()
+	t.requests = append(t.requests, req)
+	return req.ID
+}
+
+// Cancel forgets the request with id. It returns false if the request was
+// already matched or has expired.
+func (t *RequestTracker) Cancel(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+	for i, req := range t.requests {
+		if req.ID == id {
+			t.requests = append(t.requests[:i], t.requests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the number of requests still waiting for an offer.
+func (t *RequestTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+	return len(t.requests)
+}
+
+// Match finds the request that a DCC offer from nick for filename answers
+// and stops tracking it. Offers must come from the nick the request was
+// sent to. When several requests are waiting on the same nick, the one
+// whose filename is most similar wins, with ties going to the oldest.
+func (t *RequestTracker) Match(nick, filename string) (*Request, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+
+	kind := DownloadRequest
+	if strings.Contains(filename, searchResultIdentifier) {
+		kind = SearchRequest
+	}
+	offered := filenameWords(filename)
+
+	best, bestScore, candidates := -1, -1.0, 0
+	for i, req := range t.requests {
+		if req.Kind != kind || !strings.EqualFold(req.Nick, nick) {
+			continue
+		}
+		candidates++
+
+		var score float64
+		if kind == SearchRequest {
+			score = similarity(offered, filenameWords(req.Query))
+		} else {
+			score = similarity(offered, filenameWords(req.Filename))
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	// A poorly named file is still ours if nothing else could claim it
+	if best == -1 || (kind == DownloadRequest && bestScore < minSimilarity && candidates > 1) {
+		return nil, false
+	}
+
+	req := t.requests[best]
+	t.requests = append(t.requests[:best], t.requests[best+1:]...)
+	return req, true
+}
+
+// MatchOffer is Match for a raw DCC SEND line.
+func (t *RequestTracker) MatchOffer(line string) (*Request, bool) {
+	msg, err := irc.ParseMessage(line)
+	if err != nil {
+		return nil, false
+	}
+	download, err := dcc.ParseString(line)
+	if err != nil {
+		return nil, false
+	}
+	return t.Match(msg.Nick(), download.Filename)
+}
+
+// Correlate wraps handler so it is called with the request that caused each
+// offer.
+func (t *RequestTracker) Correlate(handler OfferHandlerFunc) HandlerFunc {
+	return func(text string) {
+		req, _ := t.MatchOffer(text)
+		handler(req, text)
+	}
+}
+
+// prune drops expired requests. t.mu must be held.
+func (t *RequestTracker) prune() {
+	ttl := t.TTL
+	if ttl <= 0 {
+		ttl = DefaultRequestTTL
+	}
+
+	now := t.now()
+	kept := t.requests[:0]
+	for _, req := range t.requests {
+		if now.Sub(req.Created) < ttl {
+			kept = append(kept, req)
+		}
+	}
+	for i := len(kept); i < len(t.requests); i++ {
+		t.requests[i] = nil
+	}
+	t.requests = kept
+}
+
+// splitBookLine splits "!Server filename ::INFO:: 1.2MB" into the server nick
+// and the filename.
+func splitBookLine(book string) (string, string) {
+	book = strings.TrimPrefix(strings.TrimSpace(book), "!")
+	nick, filename, _ := strings.Cut(book, " ")
+	if info := strings.Index(filename, "::INFO::"); info >= 0 {
+		filename = filename[:info]
+	}
+	return nick, strings.TrimSpace(filename)
+}
+
+// archiveExts are stripped before comparing names since servers often send
+// a different archive format than the one listed.
+var archiveExts = map[string]bool{".zip": true, ".rar": true, ".7z": true, ".gz": true, ".tar": true, ".txt": true}
+
+// filenameWords returns the lowercase words of a filename without its
+// archive extensions.
+func filenameWords(name string) map[string]bool {
+	name = strings.ToLower(name)
+	for archiveExts[path.Ext(name)] {
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// similarity is the fraction of words in the smaller set that also appear
+// in the other set.
+func similarity(a, b map[string]bool) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a))
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBookLine(t *testing.T) {
+	cases := []struct {
+		book     string
+		nick     string
+		filename string
+	}{
+		{"!DV8 F. Scott Fitzgerald - The Great Gatsby (Epub).rar", "DV8", "F. Scott Fitzgerald - The Great Gatsby (Epub).rar"},
+		{"!Horla Fitzgerald - Gatsby.epub ::INFO:: 1.2MB", "Horla", "Fitzgerald - Gatsby.epub"},
+		{"  !Ook Gatsby.epub  ", "Ook", "Gatsby.epub"},
+	}
+
+	for _, c := range cases {
+		nick, filename := splitBookLine(c.book)
+		assert.Equal(t, c.nick, nick, c.book)
+		assert.Equal(t, c.filename, filename, c.book)
+	}
+}
+
+func TestRequestTrackerMatch(t *testing.T) {
+	tracker := NewRequestTracker()
+	search := tracker.TrackSearch("@search", "the great gatsby")
+	gatsby := tracker.TrackDownload("!DV8 F. Scott Fitzgerald - The Great Gatsby (Epub).rar")
+	dune := tracker.TrackDownload("!DV8 Frank Herbert - Dune.epub ::INFO:: 1.1MB")
+	require.Equal(t, 3, tracker.Pending())
+
+	// Wrong sender
+	_, ok := tracker.Match("Horla", "Frank Herbert - Dune.epub")
+	assert.False(t, ok)
+
+	// Most similar name wins even though gatsby is older
+	req, ok := tracker.Match("dv8", "Frank Herbert - Dune.zip")
+	require.True(t, ok)
+	assert.Equal(t, dune, req.ID)
+	assert.Equal(t, DownloadRequest, req.Kind)
+
+	req, ok = tracker.MatchOffer(":Search!search@ihw PRIVMSG evan_bot :\x01DCC SEND Search_results_for__the_great_gatsby.txt.zip 2130706433 6668 1184\x01")
+	require.True(t, ok)
+	assert.Equal(t, search, req.ID)
+	assert.Equal(t, "the great gatsby", req.Query)
+
+	// The only request left from DV8 gets the file even if it is named oddly
+	req, ok = tracker.Match("DV8", "gatsby_retail.epub")
+	require.True(t, ok)
+	assert.Equal(t, gatsby, req.ID)
+
+	// Each request is matched once
+	_, ok = tracker.Match("DV8", "F. Scott Fitzgerald - The Great Gatsby (Epub).rar")
+	assert.False(t, ok)
+	assert.Zero(t, tracker.Pending())
+}
+
+func TestRequestTrackerAmbiguous(t *testing.T) {
+	tracker := NewRequestTracker()
+	tracker.TrackDownload("!DV8 Frank Herbert - Dune.epub")
+	tracker.TrackDownload("!DV8 F. Scott Fitzgerald - The Great Gatsby.epub")
+
+	// Neither name is close, so don't guess
+	_, ok := tracker.Match("DV8", "Moby Dick.epub")
+	assert.False(t, ok)
+	assert.Equal(t, 2, tracker.Pending())
+}
+
+func TestRequestTrackerExpiry(t *testing.T) {
+	now := time.Now()
+	tracker := NewRequestTracker()
+	tracker.TTL = time.Minute
+	tracker.now = func() time.Time { return now }
+
+	id := tracker.TrackDownload("!DV8 Frank Herbert - Dune.epub")
+	now = now.Add(2 * time.Minute)
+
+	_, ok := tracker.Match("DV8", "Frank Herbert - Dune.epub")
+	assert.False(t, ok)
+	assert.False(t, tracker.Cancel(id))
+}
+
+func TestRequestTrackerCorrelate(t *testing.T) {
+	tracker := NewRequestTracker()
+	id := tracker.TrackDownload("!DV8 Frank Herbert - Dune.epub")
+
+	var got []*Request
+	handler := tracker.Correlate(func(req *Request, _ string) { got = append(got, req) })
+	handler(":DV8!dv8@ihw PRIVMSG evan_bot :\x01DCC SEND Frank_Herbert_-_Dune.epub 2130706433 6669 1000\x01")
+	handler(":Horla!horla@ihw PRIVMSG evan_bot :\x01DCC SEND Dune.epub 2130706433 6669 1000\x01")
+
+	require.Len(t, got, 2)
+	require.NotNil(t, got[0])
+	assert.Equal(t, id, got[0].ID)
+	assert.Nil(t, got[1])
+}
+
+func TestRequestTrackerAdvertised(t *testing.T) {
+	tracker := NewRequestTracker()
+	tracker.TrackDownload("!Ook F Scott Fitzgerald - The Great Gatsby (retail) (epub).rar  ::INFO:: 1MB ::HASH:: 8d860602f0f43789")
+
+	req, ok := tracker.Match("Ook", "F Scott Fitzgerald - The Great Gatsby (retail) (epub).rar")
+	require.True(t, ok)
+	assert.Equal(t, "1MB", req.Size)
+	assert.Equal(t, "8d860602f0f43789", req.Hash)
+
+	book, err := parseLineV2("!Ook Frank Herbert - Dune.epub  ::INFO:: 1.1MB ::HASH:: 348c62174a5c5c29")
+	require.NoError(t, err)
+	tracker.TrackBook(book)
+
+	req, ok = tracker.Match("Ook", "Frank Herbert - Dune.epub")
+	require.True(t, ok)
+	assert.Equal(t, "!Ook Frank Herbert - Dune.epub", req.Query)
+	assert.Equal(t, "1.1 MiB", req.Size)
+	assert.Equal(t, "348c62174a5c5c29", req.Hash)
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSizeMismatch = errors.New("file size doesn't match")
+	ErrHashMismatch = errors.New("file hash doesn't match")
+)
+
+// IntegrityError is returned when a downloaded file doesn't match the size
+// or hash that was advertised for it. The file is still saved.
+type IntegrityError struct {
+	Filename string
+	Expected string
+	Actual   string
+	Err      error
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s may be corrupt: %v (expected %s, got %s)", e.Filename, e.Err, e.Expected, e.Actual)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// hashAlgorithm picks the algorithm of an advertised hex hash by its
+// length. Nil is returned when it can't be identified, like the 64 bit
+// hashes Ook sends.
+func hashAlgorithm(advertised string) hash.Hash {
+	if _, err := hex.DecodeString(advertised); err != nil {
+		return nil
+	}
+
+	switch len(advertised) {
+	case 8:
+		return crc32.NewIEEE()
+	case 32:
+		return md5.New()
+	case 40:
+		return sha1.New()
+	case 64:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// verifyFile checks the file at path against the size of the DCC offer and,
+// when req is set, the size and hash advertised in the search result. It
+// checks what it can and skips the rest.
+func verifyFile(path, filename string, size int64, req *Request) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return &IntegrityError{Filename: filename, Expected: strconv.FormatInt(size, 10) + " bytes", Actual: strconv.FormatInt(info.Size(), 10) + " bytes", Err: ErrSizeMismatch}
+	}
+	if req == nil {
+		return nil
+	}
+
+	if advertised, tolerance, ok := ParseSize(req.Size); ok {
+		if diff := size - advertised; diff > tolerance || -diff > tolerance {
+			return &IntegrityError{Filename: filename, Expected: req.Size, Actual: strconv.FormatInt(size, 10) + " bytes", Err: ErrSizeMismatch}
+		}
+	}
+
+	expected := strings.ToLower(req.Hash)
+	h := hashAlgorithm(expected)
+	if h == nil {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != expected {
+		return &IntegrityError{Filename: filename, Expected: expected, Actual: actual, Err: ErrHashMismatch}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		size  string
+		bytes int64
+	}{
+		{"109.0B", 109},
+		{"394.7KB", 404173},
+		{"5MB", 5242880},
+		{"8.00MB", 8388608},
+		{"1.65mb", 1730150},
+		{"205.10 KiB", 210022},
+		{"20.23 MiB", 21212692},
+		{"1,5 MB", 1572864},
+		{"1,024.5KB", 1049088},
+		{"2GB", 2147483648},
+	}
+
+	for _, c := range cases {
+		bytes, _, ok := ParseSize(c.size)
+		require.True(t, ok, c.size)
+		assert.Equal(t, c.bytes, bytes, c.size)
+	}
+
+	// Rounded sizes allow more slack
+	_, rounded, _ := ParseSize("5MB")
+	_, precise, _ := ParseSize("5.00MB")
+	assert.Greater(t, rounded, precise)
+
+	for _, size := range []string{"", "N/A", "MB", "5XB", "1.2.3MB"} {
+		_, _, ok := ParseSize(size)
+		assert.False(t, ok, size)
+	}
+}
+
+func TestCanonicalSize(t *testing.T) {
+	cases := map[string]string{
+		"394.7KB":    "394.7 KiB",
+		"205.10 KiB": "205.10 KiB",
+		"5MB":        "5 MiB",
+		"1,5mb":      "1.5 MiB",
+		"109.0B":     "109.0 B",
+		"2 GiB":      "2 GiB",
+		"":           "N/A",
+		"N/A":        "N/A",
+		" unknown ":  "unknown",
+	}
+
+	for size, expected := range cases {
+		assert.Equal(t, expected, CanonicalSize(size), size)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	content := []byte("The Great Gatsby, exactly as the server advertised it.")
+	path := filepath.Join(t.TempDir(), "gatsby.epub")
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	size := int64(len(content))
+
+	md5Sum := md5.Sum(content)
+	sha1Sum := sha1.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	valid := []*Request{
+		nil,
+		{},
+		{Size: fmt.Sprintf("%dB", size)},
+		{Size: "0.1KB"},
+		{Hash: fmt.Sprintf("%08x", crc32.ChecksumIEEE(content))},
+		{Hash: hex.EncodeToString(md5Sum[:])},
+		{Hash: hex.EncodeToString(sha1Sum[:])},
+		// Case doesn't matter
+		{Hash: fmt.Sprintf("%X", sha256Sum)},
+		// 64 bit hashes can't be identified and are skipped
+		{Hash: "dde55317998f25aa"},
+	}
+	for _, req := range valid {
+		assert.NoError(t, verifyFile(path, "gatsby.epub", size, req), req)
+	}
+
+	assert.ErrorIs(t, verifyFile(path, "gatsby.epub", size+1, nil), ErrSizeMismatch)
+	assert.ErrorIs(t, verifyFile(path, "gatsby.epub", size, &Request{Size: "5MB"}), ErrSizeMismatch)
+
+	err := verifyFile(path, "gatsby.epub", size, &Request{Hash: hex.EncodeToString(md5Sum[1:]) + "00"})
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	var integrityErr *IntegrityError
+	require.ErrorAs(t, err, &integrityErr)
+	assert.Equal(t, hex.EncodeToString(md5Sum[:]), integrityErr.Actual)
+}
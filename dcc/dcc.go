@@ -1,12 +1,14 @@
 package dcc
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
 	"net"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // There are two types of DCC strings this program accepts.
@@ -14,96 +16,108 @@ import (
 
 var (
 	ErrInvalidDCCString = errors.New("invalid dcc send string")
-	ErrInvalidIP        = errors.New("unable to convert int IP to string")
-	ErrMissingBytes     = errors.New("download size didn't match dcc file size. data could be missing")
+	ErrInvalidIP        = errors.New("invalid dcc address")
 )
 
-var dccRegex = regexp.MustCompile(`DCC SEND "?(.+[^"])"?\s(\d+)\s+(\d+)\s+(\d+)\s*`)
+// SSEND offers are the same as SEND offers but the transfer is wrapped in TLS.
+var dccRegex = regexp.MustCompile(`DCC (S?)SEND "?(.+[^"])"?\s(\S+)\s+(\d+)\s+(\d+)\s*`)
+
+// hostnameRegex matches the labels of a DNS name
+var hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
 
 type Download struct {
 	Filename string
-	IP       string
-	Port     string
-	Size     int64
+	// IP is an IPv4 or IPv6 address or a hostname.
+	IP   string
+	Port string
+	Size int64
+	// Token identifies a passive offer. See Passive.
+	Token string
+	// Secure is set for DCC SSEND offers, which are sent over TLS.
+	Secure bool
 }
 
 // ParseString parses the important data of a DCC SEND string
 func ParseString(text string) (*Download, error) {
+	if groups := passiveRegex.FindStringSubmatch(text); len(groups) != 0 {
+		return parsePassive(groups)
+	}
+
 	groups := dccRegex.FindStringSubmatch(text)
 
 	if len(groups) == 0 {
 		return nil, ErrInvalidDCCString
 	}
 
-	ip, err := stringToIP(groups[2])
+	ip, err := parseAddress(groups[3])
 	if err != nil {
 		return nil, err
 	}
 
-	size, err := strconv.ParseInt(groups[4], 10, 64)
+	size, err := strconv.ParseInt(groups[5], 10, 64)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Download{
-		Filename: groups[1],
+		Filename: groups[2],
 		IP:       ip,
-		Port:     groups[3],
+		Port:     groups[4],
 		Size:     size,
+		Secure:   groups[1] != "",
 	}, nil
 }
 
-// Download writes the data contained in the DCC Download
-func (download Download) Download(writer io.Writer) error {
-	// TODO: Maybe specify deadline?
-	conn, err := net.Dial("tcp", download.IP+":"+download.Port)
+func parsePassive(groups []string) (*Download, error) {
+	ip, err := parseAddress(groups[3])
 	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	// NOTE: Not using the idiomatic io.Copy or io.CopyBuffer because they are
-	// much slower in real world tests than the manual way. I suspect it has to
-	// do with the way the DCC server is sending data. I don't think it ever sends
-	// an EOF like the io.* methods expect.
-
-	// Benchmark: 2.36MB File
-	// CopyBuffer - 4096 - 2m32s, 2m18s, 2m32s
-	// Copy - 2m35s
-	// Custom - 1024 - 35s
-	// Custom - 4096 - 46s, 14s
-	received := 0
-	bytes := make([]byte, 4096)
-	for int64(received) < download.Size {
-		n, err := conn.Read(bytes)
-		if err != nil {
-			return err
-		}
-
-		_, err = writer.Write(bytes[:n])
-		if err != nil {
-			return err
-		}
-		received += n
+		return nil, err
 	}
 
-	if int64(received) != download.Size {
-		return ErrMissingBytes
+	size, err := strconv.ParseInt(groups[4], 10, 64)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &Download{
+		Filename: groups[2],
+		IP:       ip,
+		Port:     "0",
+		Size:     size,
+		Token:    groups[5],
+		Secure:   groups[1] != "",
+	}, nil
 }
 
-// Convert a given 32 bit IP integer to an IP string
-// Ex) 2907707975 -> 192.168.1.1
-func stringToIP(nn string) (string, error) {
-	temp, err := strconv.ParseUint(nn, 10, 32)
-	if err != nil {
-		return "", ErrInvalidIP
+// Download writes the data contained in the DCC Download using the default
+// Options.
+func (download Download) Download(writer io.Writer) error {
+	return download.DownloadContext(context.Background(), writer, Options{})
+}
+
+// parseAddress converts the address of a DCC offer to a string that can be
+// dialed. Most clients send IPv4 addresses as a 32 bit integer, but dotted
+// IPv4, IPv6 literals and hostnames are also used.
+// Ex) 2907707975 -> 173.80.26.71
+func parseAddress(address string) (string, error) {
+	if n, err := strconv.ParseUint(address, 10, 32); err == nil {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(n))
+		return ip.String(), nil
 	}
-	intIP := uint32(temp)
 
-	ip := make(net.IP, 4)
-	binary.BigEndian.PutUint32(ip, intIP)
-	return ip.String(), nil
+	if ip := net.ParseIP(strings.Trim(address, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+
+	host := strings.TrimSuffix(address, ".")
+	if len(host) > 253 || !hostnameRegex.MatchString(host) {
+		return "", ErrInvalidIP
+	}
+	// Top level domains are never numeric. This rejects malformed IPv4
+	// addresses and integers that don't fit in 32 bits.
+	if _, err := strconv.Atoi(host[strings.LastIndex(host, ".")+1:]); err == nil {
+		return "", ErrInvalidIP
+	}
+	return host, nil
 }
@@ -2,11 +2,26 @@ package dcc
 
 import (
 	"bytes"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/evan-buss/openbooks/mock"
+	"github.com/evan-buss/openbooks/proxy"
+	"github.com/evan-buss/openbooks/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestStringParsing makes sure that data is properly extracted from the DCC
@@ -28,6 +43,42 @@ func TestStringParsing(t *testing.T) {
 			`:DV8!HandyAndy@ihw-39fkft.ip-164-132-173.eu PRIVMSG negative-bishop-1 :DCC SEND "Douglas Adams - [HITCHHIKER'S GUIDE TO THE GALAXY & THE 01] - Hitchhiker's Guide to the Galaxy & The (v5.0) (EPUB).rar" 2760158537 2050 2321788`,
 			&Download{Filename: "Douglas Adams - [HITCHHIKER'S GUIDE TO THE GALAXY & THE 01] - Hitchhiker's Guide to the Galaxy & The (v5.0) (EPUB).rar", IP: "164.132.173.73", Port: "2050", Size: 2321788},
 		},
+		{
+			":DV8!HandyAndy@ihw-39fkft.ip-164-132-173.eu PRIVMSG evan_bot :\x01DCC SEND Book 2 0 5.epub 2760158537 0 2321788 177\x01",
+			&Download{Filename: "Book 2 0 5.epub", IP: "164.132.173.73", Port: "0", Size: 2321788, Token: "177"},
+		},
+		{
+			":DV8!HandyAndy@ihw-39fkft.ip-164-132-173.eu PRIVMSG evan_bot :\x01DCC SSEND great-gatsby.epub 2760158537 2050 358887\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "164.132.173.73", Port: "2050", Size: 358887, Secure: true},
+		},
+		{
+			":DV8!HandyAndy@ihw-39fkft.ip-164-132-173.eu PRIVMSG evan_bot :\x01DCC SSEND great-gatsby.epub 2760158537 0 358887 177\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "164.132.173.73", Port: "0", Size: 358887, Token: "177", Secure: true},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub 164.132.173.73 2050 358887\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "164.132.173.73", Port: "2050", Size: 358887},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub 2001:db8::1 2050 358887\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "2001:db8::1", Port: "2050", Size: 358887},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub [2001:DB8::1] 2050 358887\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "2001:db8::1", Port: "2050", Size: 358887},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND \"Book 1.epub\" dcc.example.com 2050 358887\x01",
+			&Download{Filename: "Book 1.epub", IP: "dcc.example.com", Port: "2050", Size: 358887},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub localhost 2050 358887\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "localhost", Port: "2050", Size: 358887},
+		},
+		{
+			":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub 2001:db8::1 0 358887 177\x01",
+			&Download{Filename: "great-gatsby.epub", IP: "2001:db8::1", Port: "0", Size: 358887, Token: "177"},
+		},
 	}
 
 	for _, table := range tables {
@@ -35,6 +86,11 @@ func TestStringParsing(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, table.download, download)
 	}
+
+	for _, address := range []string{"4294967296", "1.2.3", "256.1.1.1", "-dcc.example.com", "dcc_example.com", "dcc..example.com"} {
+		_, err := ParseString(":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC SEND great-gatsby.epub " + address + " 2050 358887\x01")
+		assert.ErrorIs(t, err, ErrInvalidIP, address)
+	}
 }
 
 func TestDownload(t *testing.T) {
@@ -64,3 +120,392 @@ func TestDownload(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, text, string(received.Data))
 }
+
+func TestDownloadThroughProxy(t *testing.T) {
+	text := "Test dcc download through a socks5 proxy."
+
+	reader := bytes.NewReader([]byte(text))
+	server := mock.DccServer{
+		Port:   ":6972",
+		Reader: reader,
+	}
+	socks := &mock.Socks5Server{Port: "127.0.0.1:6973"}
+
+	ready := make(chan struct{}, 2)
+	go server.Start(ready)
+	go socks.Start(ready)
+	<-ready
+	<-ready
+
+	dialer, err := proxy.FromURL("socks5://127.0.0.1:6973")
+	require.NoError(t, err)
+
+	textDownload := Download{
+		Filename: "test.txt",
+		IP:       "127.0.0.1",
+		Port:     "6972",
+		Size:     int64(len(text)),
+	}
+
+	received := new(mock.WriteCloser)
+	err = textDownload.DownloadContext(context.Background(), received, Options{Dialer: dialer})
+	require.NoError(t, err)
+	assert.Equal(t, text, string(received.Data))
+	assert.Equal(t, []string{"127.0.0.1:6972"}, socks.Targets())
+}
+
+func TestParseAccept(t *testing.T) {
+	tables := []struct {
+		text   string
+		accept *Accept
+	}{
+		{":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC ACCEPT file.ext 2050 1000\x01", &Accept{Filename: "file.ext", Port: "2050", Position: 1000}},
+		{`:DV8!HandyAndy@ihw PRIVMSG evan_bot :DCC ACCEPT "Book 1 2.epub" 2050 4096`, &Accept{Filename: "Book 1 2.epub", Port: "2050", Position: 4096}},
+		{":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC ACCEPT Book 1 2.epub 2050 4096\x01", &Accept{Filename: "Book 1 2.epub", Port: "2050", Position: 4096}},
+	}
+
+	for _, table := range tables {
+		accept, err := ParseAccept(table.text)
+		require.NoError(t, err)
+		assert.Equal(t, table.accept, accept)
+	}
+
+	_, err := ParseAccept(":DV8!HandyAndy@ihw PRIVMSG evan_bot :\x01DCC ACCEPT file.ext\x01")
+	assert.ErrorIs(t, err, ErrInvalidAcceptString)
+}
+
+func TestResumeRequest(t *testing.T) {
+	assert.Equal(t, "RESUME book.epub 2050 1000", ResumeRequest(&Download{Filename: "book.epub", Port: "2050"}, 1000))
+	assert.Equal(t, `RESUME "Book 1.epub" 2050 1000`, ResumeRequest(&Download{Filename: "Book 1.epub", Port: "2050"}, 1000))
+}
+
+func TestDownloadOffset(t *testing.T) {
+	text := "Test dcc download content that is resumed."
+
+	server := mock.DccServer{
+		Port:   ":6974",
+		Reader: bytes.NewReader([]byte(text)),
+	}
+	ready := make(chan struct{}, 1)
+	go server.Start(ready)
+	<-ready
+
+	server.Resume(10)
+	textDownload := Download{
+		Filename: "test.txt",
+		IP:       "127.0.0.1",
+		Port:     "6974",
+		Size:     int64(len(text)),
+	}
+
+	received := new(mock.WriteCloser)
+	err := textDownload.DownloadContext(context.Background(), received, Options{Offset: 10})
+	require.NoError(t, err)
+	assert.Equal(t, text[10:], string(received.Data))
+}
+
+func TestPassiveOptions(t *testing.T) {
+	valid := []PassiveOptions{{}, {Ports: "50000"}, {Ports: "50000-50010"}, {Ports: " 50000 - 50010 "}, {ExternalIP: "203.0.113.7"}, {ExternalIP: "2001:db8::1"}}
+	for _, options := range valid {
+		assert.NoError(t, options.Validate(), options)
+	}
+
+	invalid := []PassiveOptions{{Ports: "abc"}, {Ports: "0"}, {Ports: "50010-50000"}, {Ports: "50000-70000"}, {Ports: "50000-"}, {ExternalIP: "example.com"}}
+	for _, options := range invalid {
+		assert.Error(t, options.Validate(), options)
+	}
+}
+
+func TestPassiveReply(t *testing.T) {
+	download := &Download{Filename: "Great Gatsby.epub", Port: "0", Size: 1000, Token: "177"}
+	assert.Equal(t, `SEND "Great Gatsby.epub" 2130706433 50000 1000 177`, PassiveReply(download, net.ParseIP("127.0.0.1"), 50000))
+	assert.Equal(t, `SEND "Great Gatsby.epub" 2001:db8::1 50000 1000 177`, PassiveReply(download, net.ParseIP("2001:db8::1"), 50000))
+
+	download.Secure = true
+	assert.Equal(t, `SSEND "Great Gatsby.epub" 2130706433 50000 1000 177`, PassiveReply(download, net.ParseIP("127.0.0.1"), 50000))
+}
+
+func TestDownloadPassive(t *testing.T) {
+	text := "Test passive dcc download content."
+	server := mock.DccServer{Reader: bytes.NewReader([]byte(text))}
+
+	listener, err := PassiveOptions{}.Listen()
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go server.Connect(listener.Addr().String())
+
+	download := Download{
+		Filename: "test.txt",
+		IP:       "0.0.0.0",
+		Port:     "0",
+		Size:     int64(len(text)),
+		Token:    "1",
+	}
+
+	received := new(mock.WriteCloser)
+	require.NoError(t, download.DownloadContext(context.Background(), received, Options{Listener: listener}))
+	assert.Equal(t, text, string(received.Data))
+}
+
+// sender accepts one connection on a free port and hands it to send.
+func sender(t *testing.T, send func(conn net.Conn)) Download {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		send(conn)
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return Download{Filename: "test.txt", IP: "127.0.0.1", Port: port}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	text := []byte("Test dcc download content.")
+
+	// Nothing is listening on the closed listener's port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, closedPort, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	refused := Download{Filename: "test.txt", IP: "127.0.0.1", Port: closedPort, Size: 10}
+	err = refused.DownloadContext(context.Background(), io.Discard, Options{})
+	assert.ErrorIs(t, err, ErrRefused)
+
+	truncated := sender(t, func(conn net.Conn) { conn.Write(text[:10]) })
+	truncated.Size = int64(len(text))
+	err = truncated.DownloadContext(context.Background(), io.Discard, Options{})
+	assert.ErrorIs(t, err, ErrTruncated)
+	var transferErr *TransferError
+	require.True(t, errors.As(err, &transferErr))
+	assert.Equal(t, int64(10), transferErr.Received)
+
+	stalled := sender(t, func(conn net.Conn) {
+		conn.Write(text[:10])
+		time.Sleep(time.Second)
+	})
+	stalled.Size = int64(len(text))
+	err = stalled.DownloadContext(context.Background(), io.Discard, Options{IdleTimeout: 100 * time.Millisecond})
+	assert.ErrorIs(t, err, ErrStalled)
+}
+
+func TestDownloadCancel(t *testing.T) {
+	download := sender(t, func(conn net.Conn) { time.Sleep(time.Second) })
+	download.Size = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := download.DownloadContext(ctx, io.Discard, Options{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Cancelling while waiting for a passive sender stops the accept too
+	listener, err := PassiveOptions{}.Listen()
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	passive := Download{Filename: "test.txt", IP: "0.0.0.0", Port: "0", Size: 10, Token: "1"}
+	err = passive.DownloadContext(ctx, io.Discard, Options{Listener: listener})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDownloadAck(t *testing.T) {
+	text := []byte("Test dcc download content that is acknowledged.")
+	acks := make(chan []uint32, 1)
+
+	// A classic sender waits for each chunk to be acknowledged
+	download := sender(t, func(conn net.Conn) {
+		var received []uint32
+		for i := 0; i < len(text); i += 16 {
+			end := i + 16
+			if end > len(text) {
+				end = len(text)
+			}
+			conn.Write(text[i:end])
+
+			var ack uint32
+			for ack < uint32(end) {
+				if err := binary.Read(conn, binary.BigEndian, &ack); err != nil {
+					acks <- received
+					return
+				}
+				received = append(received, ack)
+			}
+		}
+		acks <- received
+	})
+	download.Size = int64(len(text))
+
+	received := new(mock.WriteCloser)
+	err := download.DownloadContext(context.Background(), received, Options{Ack: AckClassic})
+	require.NoError(t, err)
+	assert.Equal(t, text, received.Data)
+
+	sent := <-acks
+	require.NotEmpty(t, sent)
+	assert.Equal(t, uint32(len(text)), sent[len(sent)-1])
+}
+
+func TestManagerRate(t *testing.T) {
+	text := bytes.Repeat([]byte("openbooks"), 4096)
+	download := sender(t, func(conn net.Conn) { conn.Write(text) })
+	download.Size = int64(len(text))
+
+	// The first half fits in the initial burst, the rest takes a second
+	manager := NewManager(Limits{TransferRate: int64(len(text) / 2)})
+
+	start := time.Now()
+	received := new(mock.WriteCloser)
+	require.NoError(t, manager.Download(context.Background(), download, received, Options{}))
+	assert.Equal(t, text, received.Data)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestManagerQueue(t *testing.T) {
+	text := []byte("Test dcc download content.")
+	release := make(chan struct{})
+	first := sender(t, func(conn net.Conn) {
+		<-release
+		conn.Write(text)
+	})
+	first.Size = int64(len(text))
+
+	manager := NewManager(Limits{MaxConcurrent: 1})
+	assert.False(t, manager.Busy())
+
+	done := make(chan error, 1)
+	go func() { done <- manager.Download(context.Background(), first, io.Discard, Options{}) }()
+	require.Eventually(t, func() bool { return manager.Active() == 1 }, time.Second, 10*time.Millisecond)
+	assert.True(t, manager.Busy())
+
+	// A second transfer waits until it gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		queued <- manager.Download(ctx, Download{Filename: "second.txt", Size: 10}, io.Discard, Options{})
+	}()
+	require.Eventually(t, func() bool { return manager.Queued() == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-queued, context.Canceled)
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, 0, manager.Active())
+	assert.False(t, manager.Busy())
+}
+
+func TestManagerOrder(t *testing.T) {
+	manager := NewManager(Limits{MaxConcurrent: 1})
+	require.NoError(t, manager.Acquire(context.Background()))
+
+	served := make(chan int, 3)
+	for i := 1; i <= 3; i++ {
+		i := i
+		go func() {
+			if manager.Acquire(context.Background()) == nil {
+				served <- i
+				manager.Release()
+			}
+		}()
+		require.Eventually(t, func() bool { return manager.Queued() == i }, time.Second, time.Millisecond)
+	}
+
+	// Each freed slot goes to the transfer that waited longest
+	manager.Release()
+	order := []int{<-served, <-served, <-served}
+	assert.Equal(t, []int{1, 2, 3}, order)
+	assert.Equal(t, 0, manager.Active())
+	assert.Equal(t, 0, manager.Queued())
+}
+
+// selfSigned creates a self-signed certificate for 127.0.0.1.
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "DV8"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	cert.Leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestDownloadSecure(t *testing.T) {
+	text := []byte("Test dcc download content sent over TLS.")
+	cert := selfSigned(t)
+
+	secureSender := func() Download {
+		download := sender(t, func(conn net.Conn) {
+			secure := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if secure.Handshake() == nil {
+				secure.Write(text)
+			}
+		})
+		download.Size = int64(len(text))
+		download.Secure = true
+		return download
+	}
+
+	// Bots use self-signed certificates so they have to be pinned or trusted
+	config, err := util.TLSOptions{Pins: []string{util.SPKIPin(cert.Leaf)}, Insecure: true}.Config()
+	require.NoError(t, err)
+	received := new(mock.WriteCloser)
+	require.NoError(t, secureSender().DownloadContext(context.Background(), received, Options{TLSConfig: config}))
+	assert.Equal(t, text, received.Data)
+
+	err = secureSender().DownloadContext(context.Background(), io.Discard, Options{})
+	assert.ErrorIs(t, err, ErrHandshake)
+
+	// A matching pin is enough for a self-signed sender when pins are trusted
+	pinned, err := util.TLSOptions{Pins: []string{util.SPKIPin(cert.Leaf)}, TrustPins: true}.Config()
+	require.NoError(t, err)
+	received = new(mock.WriteCloser)
+	require.NoError(t, secureSender().DownloadContext(context.Background(), received, Options{TLSConfig: pinned}))
+	assert.Equal(t, text, received.Data)
+
+	other := selfSigned(t)
+	pinned, err = util.TLSOptions{Pins: []string{util.SPKIPin(other.Leaf)}, TrustPins: true}.Config()
+	require.NoError(t, err)
+	err = secureSender().DownloadContext(context.Background(), io.Discard, Options{TLSConfig: pinned})
+	assert.ErrorIs(t, err, ErrHandshake)
+	assert.Contains(t, err.Error(), util.ErrPinMismatch.Error())
+
+	// Plain senders fail the handshake too
+	plain := sender(t, func(conn net.Conn) { conn.Write(text) })
+	plain.Size = int64(len(text))
+	plain.Secure = true
+	err = plain.DownloadContext(context.Background(), io.Discard, Options{TLSConfig: config, ConnectTimeout: time.Second})
+	assert.ErrorIs(t, err, ErrHandshake)
+
+	listener, err := PassiveOptions{}.Listen()
+	require.NoError(t, err)
+	defer listener.Close()
+	passive := Download{Filename: "test.txt", Port: "0", Size: 10, Token: "1", Secure: true}
+	err = passive.DownloadContext(context.Background(), io.Discard, Options{Listener: listener})
+	var transferErr *TransferError
+	require.True(t, errors.As(err, &transferErr))
+	assert.Equal(t, ErrSecurePassive, transferErr.Cause)
+}
@@ -0,0 +1,168 @@
+package dcc
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/evan-buss/openbooks/util"
+)
+
+// minBurst lets a whole read through the limiter at once even for very low
+// rates.
+const minBurst = 4096
+
+// Limits caps the bandwidth and number of simultaneous DCC transfers. Zero
+// values disable the limit.
+type Limits struct {
+	// Rate is the number of bytes per second shared by every transfer.
+	Rate int64
+	// TransferRate is the number of bytes per second of a single transfer.
+	TransferRate int64
+	// MaxConcurrent is the number of transfers that run at once. Others wait
+	// in the order they arrived until a transfer finishes.
+	MaxConcurrent int
+}
+
+// Manager runs transfers within Limits. A single Manager should be shared by
+// everything that downloads so the limits apply to all of them.
+type Manager struct {
+	limits Limits
+	global *util.TokenBucket
+
+	mu     sync.Mutex
+	active int
+	// waiters are the queued transfers, first in line first. Release hands
+	// its slot to the first one by closing its channel.
+	waiters []chan struct{}
+}
+
+func NewManager(limits Limits) *Manager {
+	m := &Manager{limits: limits}
+	if limits.Rate > 0 {
+		m.global = newBucket(limits.Rate)
+	}
+	return m
+}
+
+func newBucket(rate int64) *util.TokenBucket {
+	burst := rate
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return util.NewTokenBucket(float64(rate), int(burst))
+}
+
+// Download waits for a free transfer slot and then runs the transfer like
+// DownloadContext, throttled to the manager's rates. ctx also cancels the
+// wait in the queue.
+func (m *Manager) Download(ctx context.Context, download Download, writer io.Writer, opts Options) error {
+	if err := m.Acquire(ctx); err != nil {
+		return &TransferError{Filename: download.Filename, Received: opts.Offset, Size: download.Size, Err: err}
+	}
+	defer m.Release()
+
+	return download.DownloadContext(ctx, m.Throttle(ctx, writer), opts)
+}
+
+// Throttle limits writes to writer to the manager's rates until ctx ends.
+func (m *Manager) Throttle(ctx context.Context, writer io.Writer) io.Writer {
+	limited := &throttledWriter{ctx: ctx, writer: writer}
+	if m.global != nil {
+		limited.buckets = append(limited.buckets, m.global)
+	}
+	if m.limits.TransferRate > 0 {
+		limited.buckets = append(limited.buckets, newBucket(m.limits.TransferRate))
+	}
+	return limited
+}
+
+// Active returns the number of running transfers.
+func (m *Manager) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
+
+// Queued returns the number of transfers waiting for a slot.
+func (m *Manager) Queued() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
+
+// Busy reports whether a new transfer would have to wait in the queue.
+func (m *Manager) Busy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limits.MaxConcurrent > 0 && m.active+len(m.waiters) >= m.limits.MaxConcurrent
+}
+
+// Acquire waits for a free transfer slot. Slots are handed out in the order
+// Acquire was called. Use it instead of Download when the sender has to be
+// told to connect, like for passive offers or a RESUME, so it isn't left
+// waiting while queued. Every successful Acquire must be followed by a
+// Release.
+func (m *Manager) Acquire(ctx context.Context) error {
+	m.mu.Lock()
+	if m.limits.MaxConcurrent <= 0 || (m.active < m.limits.MaxConcurrent && len(m.waiters) == 0) {
+		m.active++
+		m.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	m.waiters = append(m.waiters, ready)
+	m.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	for i, waiter := range m.waiters {
+		if waiter == ready {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			m.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	m.mu.Unlock()
+
+	// The slot was handed over just as ctx ended, pass it on
+	m.Release()
+	return ctx.Err()
+}
+
+// Release frees the slot taken by Acquire, handing it to the first queued
+// transfer.
+func (m *Manager) Release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.waiters) > 0 {
+		close(m.waiters[0])
+		m.waiters = m.waiters[1:]
+		return
+	}
+	m.active--
+}
+
+// throttledWriter delays each write until every bucket allows it. Since the
+// next read only happens after the write returns, TCP flow control slows the
+// sender down to the same rate.
+type throttledWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	buckets []*util.TokenBucket
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	for _, bucket := range w.buckets {
+		if err := bucket.Wait(w.ctx, len(p)); err != nil {
+			return 0, err
+		}
+	}
+	return w.writer.Write(p)
+}
@@ -0,0 +1,105 @@
+package dcc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPortRange  = errors.New("invalid port range. use a port like 50000 or a range like 50000-50100")
+	ErrInvalidExternalIP = errors.New("invalid external IP")
+)
+
+// Passive offers have port 0 and a token. The sender can't accept
+// connections (usually because of NAT) so we listen instead.
+var passiveRegex = regexp.MustCompile(`DCC (S?)SEND "?(.+[^"])"?\s(\S+)\s+0\s+(\d+)\s+(\d+)\s*(?:\x01|$)`)
+
+// PassiveOptions configures how passive offers are answered.
+type PassiveOptions struct {
+	// ExternalIP is the address senders connect to. Needed behind NAT.
+	// Defaults to the local address of the IRC connection.
+	ExternalIP string
+	// Ports is the port, or range of ports like "50000-50100", to listen
+	// on. Any free port is used when empty.
+	Ports string
+}
+
+// Validate reports configuration errors before any offer arrives.
+func (o PassiveOptions) Validate() error {
+	if o.ExternalIP != "" && net.ParseIP(o.ExternalIP) == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidExternalIP, o.ExternalIP)
+	}
+	_, _, err := o.portRange()
+	return err
+}
+
+func (o PassiveOptions) portRange() (int, int, error) {
+	if strings.TrimSpace(o.Ports) == "" {
+		return 0, 0, nil
+	}
+
+	low, high, isRange := strings.Cut(o.Ports, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil {
+		return 0, 0, ErrInvalidPortRange
+	}
+	max := min
+	if isRange {
+		max, err = strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return 0, 0, ErrInvalidPortRange
+		}
+	}
+
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, ErrInvalidPortRange
+	}
+	return min, max, nil
+}
+
+// Listen opens a listener on the first free port in the range.
+func (o PassiveOptions) Listen() (net.Listener, error) {
+	min, max, err := o.portRange()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for port := min; port <= max; port++ {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+		if err == nil {
+			return listener, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no free port for passive DCC in %s: %w", o.Ports, lastErr)
+}
+
+// Passive reports whether the sender expects us to listen for the transfer.
+func (download Download) Passive() bool {
+	return download.Port == "0" && download.Token != ""
+}
+
+// PassiveReply returns the CTCP DCC parameters that tell the sender of a
+// passive offer where to connect.
+func PassiveReply(download *Download, ip net.IP, port int) string {
+	address := ip.String()
+	if v4 := ip.To4(); v4 != nil {
+		address = strconv.FormatUint(uint64(binary.BigEndian.Uint32(v4)), 10)
+	}
+
+	filename := download.Filename
+	if strings.Contains(filename, " ") {
+		filename = `"` + filename + `"`
+	}
+	command := "SEND"
+	if download.Secure {
+		command = "SSEND"
+	}
+	return fmt.Sprintf("%s %s %s %d %d %s", command, filename, address, port, download.Size, download.Token)
+}
@@ -0,0 +1,48 @@
+package dcc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAcceptString = errors.New("invalid dcc accept string")
+
+var acceptRegex = regexp.MustCompile(`DCC ACCEPT "?(.+?)"?\s+(\d+)\s+(\d+)\s*(?:\x01|$)`)
+
+// Accept is the sender's answer to a DCC RESUME request. Position is where
+// the transfer will continue from.
+type Accept struct {
+	Filename string
+	Port     string
+	Position int64
+}
+
+// ResumeRequest returns the CTCP DCC parameters asking the sender of
+// download to continue from position. mIRC style senders reply with a DCC
+// ACCEPT.
+func ResumeRequest(download *Download, position int64) string {
+	filename := download.Filename
+	if strings.Contains(filename, " ") {
+		filename = `"` + filename + `"`
+	}
+	return fmt.Sprintf("RESUME %s %s %d", filename, download.Port, position)
+}
+
+// ParseAccept parses a DCC ACCEPT string. Some clients always send
+// "file.ext" as the filename so transfers should be matched by port.
+func ParseAccept(text string) (*Accept, error) {
+	groups := acceptRegex.FindStringSubmatch(text)
+	if len(groups) == 0 {
+		return nil, ErrInvalidAcceptString
+	}
+
+	position, err := strconv.ParseInt(groups[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Accept{Filename: groups[1], Port: groups[2], Position: position}, nil
+}
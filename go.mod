@@ -26,6 +26,7 @@ require (
 require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/inkeliz/gowebview v1.0.1
+	golang.org/x/text v0.3.8
 )
 
 require (
@@ -0,0 +1,97 @@
+package irc
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// saslChunkSize is the maximum length of a single AUTHENTICATE payload.
+const saslChunkSize = 400
+
+// saslState tracks the progress of SASL negotiation during registration.
+type saslState struct {
+	// account is the account name to authenticate as
+	account string
+	// caps accumulates the capabilities from a multiline CAP LS reply
+	caps []string
+	// unavailable is set when the server doesn't offer SASL, in which case
+	// we fall back to NickServ once registered.
+	unavailable bool
+	done        bool
+}
+
+// negotiateSASL advances SASL PLAIN authentication in response to msg.
+// CAP END is always sent once authentication succeeds or fails so that
+// registration can continue.
+func (i *Conn) negotiateSASL(msg *Message, state *saslState) {
+	if state.done {
+		return
+	}
+
+	switch msg.Command {
+	case CmdCap:
+		switch strings.ToUpper(msg.Param(1)) {
+		case "LS":
+			state.caps = append(state.caps, strings.Fields(msg.Trailing())...)
+			// "CAP * LS * :caps" means more lines are coming
+			if msg.Param(2) == "*" && len(msg.Params) > 3 {
+				return
+			}
+			if !hasCapability(state.caps, "sasl") {
+				state.unavailable = true
+				i.endCap(state)
+				return
+			}
+			i.sendPriority("CAP REQ :sasl")
+		case "ACK":
+			i.sendPriority("AUTHENTICATE PLAIN")
+		case "NAK":
+			state.unavailable = true
+			i.endCap(state)
+		}
+	case CmdAuthenticate:
+		if msg.Param(0) == "+" {
+			i.sendSASLCredentials(state.account)
+		}
+	case RplSaslSuccess, ErrNickLocked, ErrSaslFail, ErrSaslTooLong, ErrSaslAborted, ErrSaslAlready:
+		i.endCap(state)
+	}
+}
+
+func (i *Conn) endCap(state *saslState) {
+	state.done = true
+	i.sendPriority("CAP END")
+}
+
+// sendSASLCredentials sends the base64 encoded PLAIN credentials
+// (authzid \0 authcid \0 password), split into 400 byte chunks.
+func (i *Conn) sendSASLCredentials(account string) {
+	payload := base64.StdEncoding.EncodeToString([]byte(account + "\x00" + account + "\x00" + i.Password))
+
+	for len(payload) >= saslChunkSize {
+		i.sendPriority("AUTHENTICATE " + payload[:saslChunkSize])
+		payload = payload[saslChunkSize:]
+	}
+	if payload == "" {
+		payload = "+"
+	}
+	i.sendPriority("AUTHENTICATE " + payload)
+}
+
+// identify authenticates with NickServ. Used when SASL isn't available.
+func (i *Conn) identify(account string) {
+	i.send("PRIVMSG NickServ :IDENTIFY " + account + " " + i.Password)
+}
+
+// hasCapability checks a CAP LS list for the given capability. Capabilities
+// may have values attached, such as "sasl=PLAIN,EXTERNAL".
+func hasCapability(caps []string, name string) bool {
+	for _, c := range caps {
+		key, value, _ := strings.Cut(c, "=")
+		if key != name {
+			continue
+		}
+		return value == "" || strings.Contains(strings.ToUpper(value), "PLAIN")
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeConn returns a Conn wired to one end of an in-memory pipe. The other
+// end is returned for the test to play the server.
+func pipeConn(username string) (*Conn, net.Conn) {
+	client, server := net.Pipe()
+	conn := New(username, "OpenBooks")
+	conn.Conn = client
+	conn.decoder = NewDecoder(client)
+	conn.writer.Store(newWriter(client, conn.FloodBurst, conn.FloodInterval))
+	return conn, server
+}
+
+func TestSASLPlain(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	conn.Password = "hunter2"
+	defer server.Close()
+
+	sent := make(chan []string, 1)
+	go func() {
+		var lines []string
+		scanner := bufio.NewScanner(server)
+		reply := map[string]string{
+			"CAP REQ :sasl":      ":irc.irchighway.net CAP * ACK :sasl",
+			"AUTHENTICATE PLAIN": "AUTHENTICATE +",
+		}
+		fmt.Fprint(server, ":irc.irchighway.net CAP * LS * :multi-prefix away-notify\r\n")
+		fmt.Fprint(server, ":irc.irchighway.net CAP * LS :sasl=PLAIN,EXTERNAL\r\n")
+		for scanner.Scan() {
+			line := scanner.Text()
+			lines = append(lines, line)
+			if r, ok := reply[line]; ok {
+				fmt.Fprint(server, r+"\r\n")
+			} else if line == "CAP END" {
+				fmt.Fprint(server, ":irc.irchighway.net 001 evan_bot :Welcome\r\n")
+				sent <- lines
+				return
+			} else {
+				fmt.Fprint(server, ":irc.irchighway.net 903 evan_bot :SASL authentication successful\r\n")
+			}
+		}
+	}()
+
+	state := saslState{account: "evan"}
+	require.NoError(t, conn.register(context.Background(), true, &state))
+	assert.False(t, state.unavailable)
+
+	credentials := base64.StdEncoding.EncodeToString([]byte("evan\x00evan\x00hunter2"))
+	assert.Equal(t, []string{
+		"CAP REQ :sasl",
+		"AUTHENTICATE PLAIN",
+		"AUTHENTICATE " + credentials,
+		"CAP END",
+	}, <-sent)
+}
+
+func TestSASLUnavailable(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	conn.Password = "hunter2"
+	defer server.Close()
+
+	go func() {
+		scanner := bufio.NewScanner(server)
+		fmt.Fprint(server, ":irc.irchighway.net CAP * LS :multi-prefix away-notify\r\n")
+		for scanner.Scan() {
+			if scanner.Text() == "CAP END" {
+				fmt.Fprint(server, ":irc.irchighway.net 001 evan_bot :Welcome\r\n")
+			}
+		}
+	}()
+
+	state := saslState{account: "evan"}
+	require.NoError(t, conn.register(context.Background(), true, &state))
+	assert.True(t, state.unavailable)
+}
+
+func TestHasCapability(t *testing.T) {
+	assert.True(t, hasCapability([]string{"away-notify", "sasl"}, "sasl"))
+	assert.True(t, hasCapability([]string{"sasl=EXTERNAL,PLAIN"}, "sasl"))
+	assert.False(t, hasCapability([]string{"sasl=EXTERNAL"}, "sasl"))
+	assert.False(t, hasCapability([]string{"multi-prefix"}, "sasl"))
+}
@@ -0,0 +1,74 @@
+package irc
+
+import "strings"
+
+// ctcpDelim marks the start and end of a CTCP message.
+const ctcpDelim = "\x01"
+
+// Common CTCP commands.
+const (
+	CTCPAction     = "ACTION"
+	CTCPClientInfo = "CLIENTINFO"
+	CTCPDCC        = "DCC"
+	CTCPPing       = "PING"
+	CTCPSource     = "SOURCE"
+	CTCPTime       = "TIME"
+	CTCPVersion    = "VERSION"
+)
+
+// CTCP is a Client-To-Client Protocol message carried in the text of a
+// PRIVMSG (query) or NOTICE (reply).
+type CTCP struct {
+	Command string
+	Params  string
+}
+
+// ParseCTCP extracts a CTCP message from PRIVMSG or NOTICE text. The text
+// must start with \x01. The closing \x01 is optional since some clients
+// leave it off.
+func ParseCTCP(text string) (CTCP, bool) {
+	if !strings.HasPrefix(text, ctcpDelim) {
+		return CTCP{}, false
+	}
+
+	body := strings.TrimPrefix(text, ctcpDelim)
+	if end := strings.Index(body, ctcpDelim); end >= 0 {
+		body = body[:end]
+	}
+
+	command, params, _ := strings.Cut(body, " ")
+	if command == "" {
+		return CTCP{}, false
+	}
+	return CTCP{Command: strings.ToUpper(command), Params: params}, true
+}
+
+// String encodes the CTCP message with its delimiters.
+func (c CTCP) String() string {
+	if c.Params == "" {
+		return ctcpDelim + c.Command + ctcpDelim
+	}
+	return ctcpDelim + c.Command + " " + c.Params + ctcpDelim
+}
+
+// CTCP returns the CTCP message carried by a PRIVMSG or NOTICE.
+func (m *Message) CTCP() (CTCP, bool) {
+	if m.Command != CmdPrivmsg && m.Command != CmdNotice {
+		return CTCP{}, false
+	}
+	return ParseCTCP(m.Trailing())
+}
+
+// SendCTCP sends a CTCP query to target.
+func (i *Conn) SendCTCP(target string, query CTCP) {
+	if !i.IsConnected() {
+		return
+	}
+	i.send("PRIVMSG " + target + " :" + query.String())
+}
+
+// SendCTCPReply answers a CTCP query from target. Replies are sent as a
+// NOTICE so they never trigger automatic replies.
+func (i *Conn) SendCTCPReply(target string, reply CTCP) {
+	i.SendNotice(target, reply.String())
+}
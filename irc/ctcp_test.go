@@ -0,0 +1,52 @@
+package irc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCTCP(t *testing.T) {
+	cases := []struct {
+		text string
+		ctcp CTCP
+		ok   bool
+	}{
+		{"\x01VERSION\x01", CTCP{Command: "VERSION"}, true},
+		{"\x01PING 1699999999 123\x01", CTCP{Command: "PING", Params: "1699999999 123"}, true},
+		{"\x01time", CTCP{Command: "TIME"}, true},
+		{"\x01DCC SEND great-gatsby.epub 2907707975 4343 358887\x01", CTCP{Command: "DCC", Params: "SEND great-gatsby.epub 2907707975 4343 358887"}, true},
+		{"\x01ACTION waves\x01 trailing", CTCP{Command: "ACTION", Params: "waves"}, true},
+		{"what does \x01VERSION\x01 do?", CTCP{}, false},
+		{"\x01\x01", CTCP{}, false},
+		{"", CTCP{}, false},
+	}
+
+	for _, c := range cases {
+		ctcp, ok := ParseCTCP(c.text)
+		assert.Equal(t, c.ok, ok, c.text)
+		assert.Equal(t, c.ctcp, ctcp, c.text)
+	}
+}
+
+func TestCTCPString(t *testing.T) {
+	assert.Equal(t, "\x01VERSION\x01", CTCP{Command: "VERSION"}.String())
+	assert.Equal(t, "\x01PING 123\x01", CTCP{Command: "PING", Params: "123"}.String())
+
+	ctcp, ok := ParseCTCP(CTCP{Command: "TIME", Params: "Mon, 02 Jan 2006"}.String())
+	assert.True(t, ok)
+	assert.Equal(t, CTCP{Command: "TIME", Params: "Mon, 02 Jan 2006"}, ctcp)
+}
+
+func TestMessageCTCP(t *testing.T) {
+	msg, err := ParseMessage(":mock!mock@ihw-1x2 PRIVMSG evan_bot :\x01VERSION\x01")
+	assert.NoError(t, err)
+	ctcp, ok := msg.CTCP()
+	assert.True(t, ok)
+	assert.Equal(t, "VERSION", ctcp.Command)
+
+	msg, err = ParseMessage(":irc.irchighway.net 001 evan_bot :\x01VERSION\x01")
+	assert.NoError(t, err)
+	_, ok = msg.CTCP()
+	assert.False(t, ok)
+}
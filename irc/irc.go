@@ -1,60 +1,252 @@
 package irc
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evan-buss/openbooks/proxy"
 )
 
+// dialTimeout limits how long dialing and the TLS handshake may take.
+const dialTimeout = 30 * time.Second
+
+// ErrDisconnected is returned by Connect after Disconnect was called.
+var ErrDisconnected = errors.New("irc connection was closed with Disconnect")
+
 // Conn represents an IRC connection to a server
 type Conn struct {
 	net.Conn
 	channel  string
 	Username string
 	realname string
+	// AlternateNick picks the nickname to try when the server rejects the
+	// current one during registration. Defaults to NumericSuffix.
+	AlternateNick NickFunc
+	// MaxNickAttempts is the number of alternate nicknames to try before
+	// registration fails.
+	MaxNickAttempts int
+	// Account and Password identify a registered nickname. When set, Connect
+	// authenticates with SASL PLAIN if the connection uses TLS and the server
+	// supports it. Otherwise it falls back to NickServ IDENTIFY.
+	Account  string
+	Password string
+	// SASL enables SASL authentication. Disable it to always use NickServ.
+	SASL bool
+	// FloodBurst and FloodInterval configure outgoing flood control. Up to
+	// FloodBurst messages are sent immediately, after that one message is
+	// sent every FloodInterval.
+	FloodBurst    int
+	FloodInterval time.Duration
+	// PingInterval is how often we PING the server to measure lag and
+	// detect dead connections. Zero disables it. If no PONG arrives within
+	// PingTimeout the connection is closed and ReadMessage returns
+	// ErrPingTimeout.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// TLSConfig is used when connecting with TLS. ServerName defaults to the
+	// host being connected to. A nil config verifies the server certificate
+	// against the system roots.
+	TLSConfig *tls.Config
+	// Dialer opens the connection to the server. Set it to route the
+	// connection through a proxy. Defaults to proxy.Direct.
+	Dialer proxy.Dialer
+	// quit is set once Disconnect is called so that a dropped connection can
+	// be told apart from one we closed on purpose. It is never cleared.
+	quit atomic.Bool
+	// mu guards replacing the connection against Disconnect, so a reconnect
+	// can't undo it.
+	mu sync.Mutex
+
+	// Keepalive state. See keepalive.go
+	pingSent atomic.Int64
+	lag      atomic.Int64
+	timedOut atomic.Bool
+	pong     chan struct{}
+
+	writer  atomic.Pointer[writer]
+	decoder *Decoder
+	// backlog holds messages read while registering so the reader still
+	// receives them.
+	backlog []*Message
 }
 
 // New creates a new IRC connection to the server using the supplied username and realname
 func New(username, realname string) *Conn {
 	irc := &Conn{
-		channel:  "",
-		Username: username,
-		realname: realname,
+		channel:         "",
+		Username:        username,
+		realname:        realname,
+		AlternateNick:   NumericSuffix,
+		MaxNickAttempts: 5,
+		SASL:            true,
+		FloodBurst:      DefaultFloodBurst,
+		FloodInterval:   DefaultFloodInterval,
+		PingInterval:    DefaultPingInterval,
+		PingTimeout:     DefaultPingTimeout,
+		pong:            make(chan struct{}, 1),
 	}
 
 	return irc
 }
 
-// Connect connects to the given server at port 6667
-func (i *Conn) Connect(address string, enableTLS bool) error {
-	var conn net.Conn
-	var err error
-	if enableTLS {
-		conn, err = tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
-	} else {
-		conn, err = net.Dial("tcp", address)
+// Connect connects to the given server at port 6667 and registers the
+// connection. It returns once the server has welcomed us (RPL_WELCOME) or
+// with a *RegistrationError if no nickname was accepted. A failed TLS
+// handshake returns a *TLSError. Cancelling ctx aborts the attempt. Calling
+// Connect on a Conn that was previously connected replaces the old
+// connection, unless Disconnect was called, then it returns
+// ErrDisconnected.
+func (i *Conn) Connect(ctx context.Context, address string, enableTLS bool) error {
+	if i.quit.Load() {
+		return ErrDisconnected
+	}
+
+	dialer := i.Dialer
+	if dialer == nil {
+		dialer = proxy.Direct
 	}
 
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(dialCtx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	if enableTLS {
+		config := &tls.Config{}
+		if i.TLSConfig != nil {
+			config = i.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(dialCtx); err != nil {
+			conn.Close()
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return &TLSError{Address: address, Err: err}
+		}
+		conn = tlsConn
+	}
+
+	w := newWriter(conn, i.FloodBurst, i.FloodInterval)
+	i.mu.Lock()
+	// Disconnect was called while dialing
+	if i.quit.Load() {
+		i.mu.Unlock()
+		w.stop()
+		conn.Close()
+		return ErrDisconnected
+	}
+	if old := i.writer.Swap(w); old != nil {
+		old.stop()
+	}
+	if i.Conn != nil {
+		i.Conn.Close()
+	}
 	i.Conn = conn
+	i.mu.Unlock()
+
+	i.timedOut.Store(false)
+	i.lag.Store(0)
+	i.decoder = NewDecoder(conn)
+	i.backlog = nil
 
-	user := "USER " + i.Username + " 0 * :" + i.Username + "\r\n"
-	nick := "NICK " + i.Username + "\r\n"
+	// SASL credentials are only ever sent over an encrypted connection
+	useSASL := i.SASL && enableTLS && i.Password != ""
+	if useSASL {
+		// Registration is suspended until we send CAP END
+		i.sendPriority("CAP LS 302")
+	}
+
+	i.sendPriority("USER " + i.Username + " 0 * :" + i.Username)
+	i.sendPriority("NICK " + i.Username)
 
-	i.Write([]byte(user))
-	i.Write([]byte(nick))
+	// The account defaults to the nickname we asked for, not an alternate
+	// one the server may have assigned.
+	sasl := saslState{account: i.Account}
+	if sasl.account == "" {
+		sasl.account = i.Username
+	}
+
+	err = i.register(ctx, useSASL, &sasl)
+	if err != nil {
+		w.stop()
+		conn.Close()
+		return err
+	}
+	go i.keepalive(w)
+
+	if i.Password != "" && (!useSASL || sasl.unavailable) {
+		i.identify(sasl.account)
+	}
 	return nil
 }
 
-// Disconnect closes connection to the IRC server
+// ReadMessage returns the next message received from the server, starting
+// with any messages that were read during registration. PONGs answering our
+// keepalive PINGs update Lag. If the server stopped answering them,
+// ReadMessage returns ErrPingTimeout.
+func (i *Conn) ReadMessage() (*Message, error) {
+	var msg *Message
+	if len(i.backlog) > 0 {
+		msg = i.backlog[0]
+		i.backlog = i.backlog[1:]
+	} else {
+		if i.decoder == nil {
+			return nil, io.EOF
+		}
+
+		var err error
+		msg, err = i.decoder.Decode()
+		if err != nil {
+			if i.timedOut.Load() {
+				return nil, ErrPingTimeout
+			}
+			return nil, err
+		}
+	}
+
+	if msg.Command == CmdPong {
+		i.handlePong(msg)
+	}
+	return msg, nil
+}
+
+// Disconnect sends QUIT, waiting briefly for it to be written, and closes
+// the connection to the IRC server
 func (i *Conn) Disconnect() {
+	i.mu.Lock()
 	if !i.IsConnected() {
+		// Stop a Connect that is still dialing
+		i.quit.Store(true)
+		i.mu.Unlock()
 		return
 	}
-	i.Write([]byte("QUIT :Goodbye\r\n"))
-	i.Conn.Close()
+	i.quit.Store(true)
+	w, conn := i.writer.Load(), i.Conn
+	i.mu.Unlock()
+
+	written := make(chan error, 1)
+	if w.enqueue(w.priority, outgoing{line: formatLine("QUIT :Goodbye"), written: written}) == nil {
+		select {
+		case <-written:
+		case <-time.After(quitTimeout):
+		}
+	}
+	w.stop()
+	conn.Close()
 }
 
 // SendMessage sends the given message string to the connected IRC server
@@ -62,7 +254,7 @@ func (i *Conn) SendMessage(message string) {
 	if !i.IsConnected() {
 		return
 	}
-	i.Write([]byte("PRIVMSG #" + i.channel + " :" + message + "\r\n"))
+	i.send("PRIVMSG #" + i.channel + " :" + message)
 }
 
 // SendNotice sends a notice message to the specified user
@@ -70,7 +262,7 @@ func (i *Conn) SendNotice(user string, message string) {
 	if !i.IsConnected() {
 		return
 	}
-	i.Write([]byte("NOTICE " + user + " :" + message + "\r\n"))
+	i.send("NOTICE " + user + " :" + message)
 }
 
 // JoinChannel joins the channel given by channel string
@@ -79,7 +271,7 @@ func (i *Conn) JoinChannel(channel string) {
 		return
 	}
 	i.channel = channel
-	i.Write([]byte("JOIN #" + channel + "\r\n"))
+	i.send("JOIN #" + channel)
 }
 
 // GetUsers sends a NAMES request to the IRC server
@@ -87,18 +279,20 @@ func (i *Conn) GetUsers(channel string) {
 	if !i.IsConnected() {
 		return
 	}
-	i.Write([]byte("NAMES #" + channel + "\r\n"))
+	i.send("NAMES #" + channel)
 }
 
-// Pong sends a Pong message to the server, often used after a PING request
+// Pong sends a Pong message to the server, often used after a PING request.
+// PONG skips flood control so we never time out behind a queue of messages.
 func (i *Conn) Pong(server string) {
 	if !i.IsConnected() {
 		return
 	}
-	i.Write([]byte("PONG " + server + "\r\n"))
+	i.sendPriority("PONG " + server)
 }
 
-// IsConnected returns true if the IRC connection is not null
+// IsConnected returns true if the IRC connection has been established and
+// hasn't been closed with Disconnect
 func (i *Conn) IsConnected() bool {
-	return i.Conn != nil
+	return i.writer.Load() != nil && !i.quit.Load()
 }
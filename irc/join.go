@@ -0,0 +1,95 @@
+package irc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// joinTimeout is how long the server has to confirm a JOIN.
+const joinTimeout = 30 * time.Second
+
+// JoinError is returned by Join when the server refuses to let us into the
+// channel.
+type JoinError struct {
+	Channel string
+	Code    string
+	Reason  string
+}
+
+func (e *JoinError) Error() string {
+	return fmt.Sprintf("unable to join #%s: %s %s", e.Channel, e.Code, e.Reason)
+}
+
+// Join joins the channel and waits until the server has sent the end of the
+// channel's NAMES list (RPL_ENDOFNAMES), which marks a completed join.
+// Messages read while waiting, including the NAMES reply, are kept for
+// ReadMessage. Join must not be called while another goroutine is reading
+// from the connection.
+func (i *Conn) Join(ctx context.Context, channel string) error {
+	if !i.IsConnected() {
+		return ErrWriterClosed
+	}
+	i.JoinChannel(channel)
+
+	stop := i.watchContext(ctx, joinTimeout)
+	defer stop()
+
+	target := "#" + channel
+	for {
+		msg, err := i.decoder.Decode()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("waiting to join %s: %w", target, err)
+		}
+
+		switch msg.Command {
+		case CmdPing:
+			i.Pong(msg.Trailing())
+			continue
+		case RplEndOfNames:
+			if strings.EqualFold(msg.Param(1), target) {
+				i.backlog = append(i.backlog, msg)
+				return nil
+			}
+		case ErrNoSuchChannel, ErrTooManyChannels, ErrChannelIsFull, ErrInviteOnlyChan,
+			ErrBannedFromChan, ErrBadChannelKey, ErrNeedReggedNick:
+			if strings.EqualFold(msg.Param(1), target) {
+				return &JoinError{Channel: channel, Code: msg.Command, Reason: msg.Trailing()}
+			}
+		case CmdError:
+			return fmt.Errorf("waiting to join %s: server closed the connection: %s", target, msg.Trailing())
+		}
+
+		i.backlog = append(i.backlog, msg)
+	}
+}
+
+// watchContext limits reads from the connection to timeout and aborts them
+// when ctx is done. The returned function must be called once reading is
+// finished to clear the deadline.
+func (i *Conn) watchContext(ctx context.Context, timeout time.Duration) func() {
+	conn := i.Conn
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			// Unblock the pending read
+			conn.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-exited
+		conn.SetReadDeadline(time.Time{})
+	}
+}
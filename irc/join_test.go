@@ -0,0 +1,101 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replyToJoin answers the first JOIN with reply.
+func replyToJoin(server net.Conn, reply ...string) {
+	scanner := bufio.NewScanner(server)
+	for scanner.Scan() {
+		if scanner.Text() == "JOIN #ebooks" {
+			for _, line := range reply {
+				fmt.Fprint(server, line+"\r\n")
+			}
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	defer server.Close()
+
+	go replyToJoin(server,
+		":evan_bot!evan@irc.irchighway.net JOIN #ebooks",
+		"PING :irc.irchighway.net",
+		":irc.irchighway.net 332 evan_bot #ebooks :Welcome to #ebooks",
+		":irc.irchighway.net 353 evan_bot = #ebooks :evan_bot ~DV8 +Search",
+		":irc.irchighway.net 366 evan_bot #ebooks :End of /NAMES list.",
+	)
+
+	require.NoError(t, conn.Join(context.Background(), "ebooks"))
+
+	// Everything except the PING is kept for the reader
+	var commands []string
+	for len(conn.backlog) > 0 {
+		msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		commands = append(commands, msg.Command)
+	}
+	assert.Equal(t, []string{CmdJoin, RplTopic, RplNamReply, RplEndOfNames}, commands)
+}
+
+func TestJoinRefused(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	defer server.Close()
+
+	go replyToJoin(server, ":irc.irchighway.net 474 evan_bot #ebooks :Cannot join channel (+b)")
+
+	err := conn.Join(context.Background(), "ebooks")
+	var joinErr *JoinError
+	require.ErrorAs(t, err, &joinErr)
+	assert.Equal(t, ErrBannedFromChan, joinErr.Code)
+	assert.Equal(t, "ebooks", joinErr.Channel)
+}
+
+func TestJoinCancelled(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	defer server.Close()
+
+	// The server never confirms the join
+	go replyToJoin(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := conn.Join(ctx, "ebooks")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestConnectCancelled(t *testing.T) {
+	// The server accepts the connection but never welcomes us
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			bufio.NewScanner(conn).Scan()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	conn := New("evan_bot", "OpenBooks")
+	err = conn.Connect(ctx, listener.Addr().String(), false)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+}
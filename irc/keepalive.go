@@ -0,0 +1,92 @@
+package irc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPingInterval = time.Minute
+	DefaultPingTimeout  = time.Minute
+)
+
+// pingPrefix marks the PINGs we send so their PONGs can be told apart from
+// other PONGs.
+const pingPrefix = "openbooks-"
+
+var ErrPingTimeout = errors.New("no reply to PING within the ping timeout. the connection is dead")
+
+// keepalive sends a PING every PingInterval and closes the connection if
+// the matching PONG doesn't arrive within PingTimeout. A dropped connection
+// is then noticed by the reader instead of going unnoticed until the OS
+// gives up on it. It runs until w is stopped.
+func (i *Conn) keepalive(w *writer) {
+	interval, timeout := i.PingInterval, i.PingTimeout
+	if interval <= 0 {
+		return
+	}
+	if timeout <= 0 {
+		timeout = DefaultPingTimeout
+	}
+
+	// The writer's conn, not i.Conn, which a reconnect replaces
+	conn := w.conn
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		// Drop a PONG left over from an earlier connection
+		select {
+		case <-i.pong:
+		default:
+		}
+
+		sent := time.Now()
+		i.pingSent.Store(sent.UnixNano())
+		ping := formatLine("PING :" + pingPrefix + strconv.FormatInt(sent.UnixNano(), 10))
+		if w.enqueue(w.priority, outgoing{line: ping}) != nil {
+			return
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-i.pong:
+		case <-time.After(timeout):
+			i.timedOut.Store(true)
+			i.lag.Store(0)
+			conn.Close()
+			return
+		}
+	}
+}
+
+// handlePong records the lag when msg answers our most recent PING.
+func (i *Conn) handlePong(msg *Message) {
+	token := msg.Trailing()
+	if !strings.HasPrefix(token, pingPrefix) {
+		return
+	}
+
+	sent, err := strconv.ParseInt(strings.TrimPrefix(token, pingPrefix), 10, 64)
+	if err != nil || sent != i.pingSent.Load() {
+		return
+	}
+
+	i.lag.Store(int64(time.Since(time.Unix(0, sent))))
+	select {
+	case i.pong <- struct{}{}:
+	default:
+	}
+}
+
+// Lag returns the round trip time of the last PING we sent. It is zero until
+// the first PONG has been received and after a PING timed out.
+func (i *Conn) Lag() time.Duration {
+	return time.Duration(i.lag.Load())
+}
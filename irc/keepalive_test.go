@@ -0,0 +1,98 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startPingServer welcomes the client and, if answer is true, replies to
+// every PING after delay.
+func startPingServer(t *testing.T, answer bool, delay time.Duration) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "NICK "):
+				fmt.Fprintf(conn, ":irc.test.net 001 %s :Welcome\r\n", strings.TrimPrefix(line, "NICK "))
+			case strings.HasPrefix(line, "PING ") && answer:
+				time.Sleep(delay)
+				fmt.Fprintf(conn, ":irc.test.net PONG irc.test.net %s\r\n", strings.TrimPrefix(line, "PING "))
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestLag(t *testing.T) {
+	address := startPingServer(t, true, 20*time.Millisecond)
+
+	conn := New("evan_bot", "OpenBooks")
+	conn.PingInterval = 10 * time.Millisecond
+	conn.PingTimeout = time.Second
+	require.NoError(t, conn.Connect(context.Background(), address, false))
+	defer conn.Disconnect()
+	assert.Zero(t, conn.Lag())
+
+	for conn.Lag() == 0 {
+		msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		if msg.Command == CmdPong {
+			break
+		}
+	}
+
+	assert.GreaterOrEqual(t, conn.Lag(), 20*time.Millisecond)
+	assert.Less(t, conn.Lag(), time.Second)
+}
+
+func TestPingTimeout(t *testing.T) {
+	address := startPingServer(t, false, 0)
+
+	conn := New("evan_bot", "OpenBooks")
+	conn.PingInterval = 10 * time.Millisecond
+	conn.PingTimeout = 50 * time.Millisecond
+	require.NoError(t, conn.Connect(context.Background(), address, false))
+	defer conn.Disconnect()
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrPingTimeout)
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead connection was not detected")
+	}
+
+	// The connection wasn't closed on purpose, so it still reports as
+	// connected and a supervisor will reconnect it.
+	assert.True(t, conn.IsConnected())
+	assert.Zero(t, conn.Lag())
+}
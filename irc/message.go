@@ -0,0 +1,228 @@
+package irc
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrEmptyMessage   = errors.New("empty irc message")
+	ErrMissingCommand = errors.New("irc message has no command")
+)
+
+// maxLineLength is the largest line the Decoder accepts. RFC 1459 limits
+// messages to 512 bytes, but IRCv3 message tags may add up to 8191 more.
+const maxLineLength = 512 + 8191
+
+// Prefix is the optional source of a message. Messages sent by the server
+// itself only have a Name, messages from other users are formatted as
+// nick!user@host.
+type Prefix struct {
+	Name string
+	User string
+	Host string
+}
+
+// IsServer returns true if the prefix identifies a server rather than a user.
+func (p Prefix) IsServer() bool {
+	return p.User == "" && p.Host == "" && strings.Contains(p.Name, ".")
+}
+
+func (p Prefix) String() string {
+	result := p.Name
+	if p.User != "" {
+		result += "!" + p.User
+	}
+	if p.Host != "" {
+		result += "@" + p.Host
+	}
+	return result
+}
+
+// Message is a single RFC 1459 / RFC 2812 protocol message with optional
+// IRCv3 message tags.
+type Message struct {
+	// Raw is the line as it was received, without the trailing CRLF.
+	Raw     string
+	Tags    map[string]string
+	Prefix  Prefix
+	Command string
+	// Params contains every parameter of the message. If the message had a
+	// trailing parameter it is always the last item.
+	Params []string
+}
+
+// ParseMessage parses a single line received from an IRC server.
+// Format: [@tags] [:prefix] command [params] [:trailing]
+func ParseMessage(line string) (*Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	msg := &Message{Raw: line}
+
+	rest := strings.TrimLeft(line, " ")
+	if rest == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	if rest[0] == '@' {
+		var tags string
+		tags, rest = splitWord(rest[1:])
+		msg.Tags = parseTags(tags)
+	}
+
+	if strings.HasPrefix(rest, ":") {
+		var prefix string
+		prefix, rest = splitWord(rest[1:])
+		msg.Prefix = parsePrefix(prefix)
+	}
+
+	msg.Command, rest = splitWord(rest)
+	if msg.Command == "" {
+		return nil, ErrMissingCommand
+	}
+	msg.Command = strings.ToUpper(msg.Command)
+
+	for rest != "" {
+		if rest[0] == ':' {
+			msg.Params = append(msg.Params, rest[1:])
+			break
+		}
+		var param string
+		param, rest = splitWord(rest)
+		msg.Params = append(msg.Params, param)
+	}
+
+	return msg, nil
+}
+
+// Param returns the parameter at index i or an empty string if it doesn't exist.
+func (m *Message) Param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
+// Trailing returns the last parameter of the message. For PRIVMSG and NOTICE
+// this is the message text.
+func (m *Message) Trailing() string {
+	return m.Param(len(m.Params) - 1)
+}
+
+// Nick returns the nickname (or server name) that sent the message.
+func (m *Message) Nick() string {
+	return m.Prefix.Name
+}
+
+// String encodes the message in wire format without the trailing CRLF.
+func (m *Message) String() string {
+	var sb strings.Builder
+
+	if len(m.Tags) > 0 {
+		sb.WriteByte('@')
+		first := true
+		for key, value := range m.Tags {
+			if !first {
+				sb.WriteByte(';')
+			}
+			first = false
+			sb.WriteString(key)
+			if value != "" {
+				sb.WriteByte('=')
+				sb.WriteString(escapeTag(value))
+			}
+		}
+		sb.WriteByte(' ')
+	}
+
+	if m.Prefix.Name != "" {
+		sb.WriteByte(':')
+		sb.WriteString(m.Prefix.String())
+		sb.WriteByte(' ')
+	}
+
+	sb.WriteString(m.Command)
+
+	for i, param := range m.Params {
+		sb.WriteByte(' ')
+		last := i == len(m.Params)-1
+		if last && (param == "" || strings.Contains(param, " ") || param[0] == ':') {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(param)
+	}
+
+	return sb.String()
+}
+
+// Decoder reads and parses IRC messages from an input stream.
+type Decoder struct {
+	scanner *bufio.Scanner
+}
+
+// NewDecoder returns a Decoder that reads CRLF (or LF) terminated lines from r.
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+	return &Decoder{scanner: scanner}
+}
+
+// Decode returns the next message in the stream. Blank lines are skipped.
+// io.EOF is returned once the underlying reader is exhausted.
+func (d *Decoder) Decode() (*Message, error) {
+	for d.scanner.Scan() {
+		msg, err := ParseMessage(d.scanner.Text())
+		if errors.Is(err, ErrEmptyMessage) {
+			continue
+		}
+		return msg, err
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func splitWord(s string) (string, string) {
+	word, rest, _ := strings.Cut(s, " ")
+	return word, strings.TrimLeft(rest, " ")
+}
+
+func parsePrefix(raw string) Prefix {
+	var prefix Prefix
+	if at := strings.Index(raw, "@"); at != -1 {
+		prefix.Host = raw[at+1:]
+		raw = raw[:at]
+	}
+	if bang := strings.Index(raw, "!"); bang != -1 {
+		prefix.User = raw[bang+1:]
+		raw = raw[:bang]
+	}
+	prefix.Name = raw
+	return prefix
+}
+
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw, ";") {
+		if tag == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = unescapeTag(value)
+	}
+	return tags
+}
+
+var tagUnescaper = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+var tagEscaper = strings.NewReplacer(";", `\:`, " ", `\s`, `\`, `\\`, "\r", `\r`, "\n", `\n`)
+
+func unescapeTag(value string) string {
+	return tagUnescaper.Replace(value)
+}
+
+func escapeTag(value string) string {
+	return tagEscaper.Replace(value)
+}
@@ -0,0 +1,194 @@
+package irc
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseMessage runs the parser against lines captured from irc.irchighway.net
+func TestParseMessage(t *testing.T) {
+	cases := []struct {
+		reason string
+		line   string
+		want   Message
+	}{
+		{
+			"server notice before registration",
+			":irc.irchighway.net NOTICE * :*** Looking up your hostname...",
+			Message{
+				Prefix:  Prefix{Name: "irc.irchighway.net"},
+				Command: "NOTICE",
+				Params:  []string{"*", "*** Looking up your hostname..."},
+			},
+		},
+		{
+			"ping without prefix",
+			"PING :3A5B12FF",
+			Message{
+				Command: "PING",
+				Params:  []string{"3A5B12FF"},
+			},
+		},
+		{
+			"welcome numeric",
+			":irc.irchighway.net 001 evan_bot :Welcome to the IRC Highway IRC Network evan_bot!evan_bot@ihw-abc.res.spectrum.com",
+			Message{
+				Prefix:  Prefix{Name: "irc.irchighway.net"},
+				Command: "001",
+				Params:  []string{"evan_bot", "Welcome to the IRC Highway IRC Network evan_bot!evan_bot@ihw-abc.res.spectrum.com"},
+			},
+		},
+		{
+			"join confirmation",
+			":evan_bot!evan_bot@ihw-abc.res.spectrum.com JOIN :#ebooks",
+			Message{
+				Prefix:  Prefix{Name: "evan_bot", User: "evan_bot", Host: "ihw-abc.res.spectrum.com"},
+				Command: "JOIN",
+				Params:  []string{"#ebooks"},
+			},
+		},
+		{
+			"names reply",
+			":irc.irchighway.net 353 evan_bot = #ebooks :evan_bot ~DV8 +Horla @Oatmeal",
+			Message{
+				Prefix:  Prefix{Name: "irc.irchighway.net"},
+				Command: "353",
+				Params:  []string{"evan_bot", "=", "#ebooks", "evan_bot ~DV8 +Horla @Oatmeal"},
+			},
+		},
+		{
+			"end of names",
+			":irc.irchighway.net 366 evan_bot #ebooks :End of /NAMES list.",
+			Message{
+				Prefix:  Prefix{Name: "irc.irchighway.net"},
+				Command: "366",
+				Params:  []string{"evan_bot", "#ebooks", "End of /NAMES list."},
+			},
+		},
+		{
+			"dcc send with ctcp delimiters",
+			":Search!Search@ihw-4q5hcb.dyn.suddenlink.net PRIVMSG evan_bot :\x01DCC SEND SearchBot_results_for__stephen_king_the_stand.txt.zip 2907707975 4342 1116\x01",
+			Message{
+				Prefix:  Prefix{Name: "Search", User: "Search", Host: "ihw-4q5hcb.dyn.suddenlink.net"},
+				Command: "PRIVMSG",
+				Params:  []string{"evan_bot", "\x01DCC SEND SearchBot_results_for__stephen_king_the_stand.txt.zip 2907707975 4342 1116\x01"},
+			},
+		},
+		{
+			"dcc send with quoted filename",
+			`:DV8!HandyAndy@ihw-39fkft.ip-164-132-173.eu PRIVMSG negative-bishop-1 :DCC SEND "Douglas Adams - Hitchhiker's Guide to the Galaxy (v5.0) (EPUB).rar" 2760158537 2050 2321788`,
+			Message{
+				Prefix:  Prefix{Name: "DV8", User: "HandyAndy", Host: "ihw-39fkft.ip-164-132-173.eu"},
+				Command: "PRIVMSG",
+				Params:  []string{"negative-bishop-1", `DCC SEND "Douglas Adams - Hitchhiker's Guide to the Galaxy (v5.0) (EPUB).rar" 2760158537 2050 2321788`},
+			},
+		},
+		{
+			"search accepted notice",
+			`:SearchOok!ook@only.ook NOTICE evan_28 :Your search for "hp lovecraft" has been accepted. Searching...`,
+			Message{
+				Prefix:  Prefix{Name: "SearchOok", User: "ook", Host: "only.ook"},
+				Command: "NOTICE",
+				Params:  []string{"evan_28", `Your search for "hp lovecraft" has been accepted. Searching...`},
+			},
+		},
+		{
+			"channel message mentioning PING",
+			":reader!~reader@ihw-9k2.dsl.example.net PRIVMSG #ebooks :PING me when Oatmeal has 27 matches",
+			Message{
+				Prefix:  Prefix{Name: "reader", User: "~reader", Host: "ihw-9k2.dsl.example.net"},
+				Command: "PRIVMSG",
+				Params:  []string{"#ebooks", "PING me when Oatmeal has 27 matches"},
+			},
+		},
+		{
+			"ctcp version inquiry",
+			":mock_server PRIVMSG evan_28 :\x01VERSION\x01",
+			Message{
+				Prefix:  Prefix{Name: "mock_server"},
+				Command: "PRIVMSG",
+				Params:  []string{"evan_28", "\x01VERSION\x01"},
+			},
+		},
+		{
+			"message tags",
+			`@time=2022-09-01T12:00:00.000Z;account=evan;msg=a\sb\:c :evan!evan@ihw-abc PRIVMSG #ebooks :hello`,
+			Message{
+				Tags:    map[string]string{"time": "2022-09-01T12:00:00.000Z", "account": "evan", "msg": "a b;c"},
+				Prefix:  Prefix{Name: "evan", User: "evan", Host: "ihw-abc"},
+				Command: "PRIVMSG",
+				Params:  []string{"#ebooks", "hello"},
+			},
+		},
+		{
+			"no trailing parameter, lowercase command",
+			"mode evan_bot +ix",
+			Message{
+				Command: "MODE",
+				Params:  []string{"evan_bot", "+ix"},
+			},
+		},
+		{
+			"empty trailing parameter",
+			":irc.irchighway.net 332 evan_bot #ebooks :",
+			Message{
+				Prefix:  Prefix{Name: "irc.irchighway.net"},
+				Command: "332",
+				Params:  []string{"evan_bot", "#ebooks", ""},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		msg, err := ParseMessage(c.line + "\r\n")
+		require.NoError(t, err, c.reason)
+
+		c.want.Raw = c.line
+		assert.Equal(t, &c.want, msg, c.reason)
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	_, err := ParseMessage("\r\n")
+	assert.ErrorIs(t, err, ErrEmptyMessage)
+
+	_, err = ParseMessage(":irc.irchighway.net")
+	assert.ErrorIs(t, err, ErrMissingCommand)
+}
+
+func TestMessageString(t *testing.T) {
+	lines := []string{
+		":irc.irchighway.net 366 evan_bot #ebooks :End of /NAMES list.",
+		":evan_bot!evan_bot@ihw-abc.res.spectrum.com JOIN #ebooks",
+		"PRIVMSG #ebooks :@search the great gatsby",
+		"PONG 3A5B12FF",
+		"PRIVMSG #ebooks ::)",
+	}
+
+	for _, line := range lines {
+		msg, err := ParseMessage(line)
+		require.NoError(t, err)
+		assert.Equal(t, line, msg.String())
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	stream := "PING :irc.irchighway.net\r\n\r\n:Search!Search@ihw NOTICE evan :Sorry\nPING :again\r\n"
+	decoder := NewDecoder(strings.NewReader(stream))
+
+	commands := []string{}
+	for {
+		msg, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		commands = append(commands, msg.Command)
+	}
+
+	assert.Equal(t, []string{"PING", "NOTICE", "PING"}, commands)
+}
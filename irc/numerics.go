@@ -0,0 +1,42 @@
+package irc
+
+// Commands and numeric replies used by OpenBooks. See RFC 2812 section 5.
+const (
+	CmdPing    = "PING"
+	CmdPong    = "PONG"
+	CmdPrivmsg = "PRIVMSG"
+	CmdNotice  = "NOTICE"
+	CmdJoin    = "JOIN"
+	CmdNick    = "NICK"
+	CmdError   = "ERROR"
+
+	CmdCap          = "CAP"
+	CmdAuthenticate = "AUTHENTICATE"
+
+	RplWelcome    = "001"
+	RplTopic      = "332"
+	RplNamReply   = "353"
+	RplEndOfNames = "366"
+
+	ErrNoSuchChannel    = "403"
+	ErrTooManyChannels  = "405"
+	ErrErroneusNickname = "432"
+	ErrNicknameInUse    = "433"
+	ErrNickCollision    = "436"
+	ErrUnavailResource  = "437"
+	ErrYoureBannedCreep = "465"
+	ErrChannelIsFull    = "471"
+	ErrInviteOnlyChan   = "473"
+	ErrBannedFromChan   = "474"
+	ErrBadChannelKey    = "475"
+	ErrNeedReggedNick   = "477"
+
+	// IRCv3 SASL numerics
+	RplLoggedIn    = "900"
+	RplSaslSuccess = "903"
+	ErrNickLocked  = "902"
+	ErrSaslFail    = "904"
+	ErrSaslTooLong = "905"
+	ErrSaslAborted = "906"
+	ErrSaslAlready = "907"
+)
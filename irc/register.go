@@ -0,0 +1,106 @@
+package irc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// registrationTimeout is how long the server has to welcome us after we send
+// USER and NICK.
+const registrationTimeout = time.Minute
+
+// NickFunc returns the nickname to try after nick was rejected by the
+// server. attempt starts at 1 and increases with every rejection.
+type NickFunc func(nick string, attempt int) string
+
+// NumericSuffix appends the attempt number to the nickname: evan, evan1, evan2...
+func NumericSuffix(nick string, attempt int) string {
+	return nick + strconv.Itoa(attempt)
+}
+
+// RegistrationError is returned by Connect when the server never accepted
+// the connection.
+type RegistrationError struct {
+	// Nick is the last nickname that was tried.
+	Nick string
+	// Code is the numeric reply or command that ended registration. It is
+	// empty if the connection failed before the server replied.
+	Code   string
+	Reason string
+	Err    error
+}
+
+func (e *RegistrationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("irc registration as %q failed: %s", e.Nick, e.Err)
+	}
+	return fmt.Sprintf("irc registration as %q failed: %s %s", e.Nick, e.Code, e.Reason)
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// register waits for RPL_WELCOME, answering PINGs and picking a new
+// nickname when the current one is rejected. If useSASL is true it also
+// negotiates the sasl capability and authenticates before ending CAP
+// negotiation.
+func (i *Conn) register(ctx context.Context, useSASL bool, sasl *saslState) error {
+	stop := i.watchContext(ctx, registrationTimeout)
+	defer stop()
+
+	alternate := i.AlternateNick
+	if alternate == nil {
+		alternate = NumericSuffix
+	}
+
+	base := i.Username
+	nick := i.Username
+	attempts := 0
+
+	for {
+		msg, err := i.decoder.Decode()
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			return &RegistrationError{Nick: nick, Err: err}
+		}
+
+		switch msg.Command {
+		case CmdPing:
+			// Some servers (including irchighway) require a PONG before they
+			// finish registration. The reader doesn't need to see it.
+			i.Pong(msg.Trailing())
+			continue
+		case RplWelcome:
+			// The server ignored CAP LS, so it doesn't support SASL
+			if useSASL && !sasl.done {
+				sasl.unavailable = true
+			}
+			i.Username = nick
+			if confirmed := msg.Param(0); confirmed != "" && confirmed != "*" {
+				i.Username = confirmed
+			}
+			i.backlog = append(i.backlog, msg)
+			return nil
+		case ErrErroneusNickname, ErrNicknameInUse, ErrNickCollision, ErrUnavailResource:
+			attempts++
+			if attempts > i.MaxNickAttempts {
+				return &RegistrationError{Nick: nick, Code: msg.Command, Reason: msg.Trailing()}
+			}
+			nick = alternate(base, attempts)
+			i.sendPriority("NICK " + nick)
+		case CmdCap, CmdAuthenticate, RplSaslSuccess, ErrNickLocked, ErrSaslFail, ErrSaslTooLong, ErrSaslAborted, ErrSaslAlready:
+			if useSASL {
+				i.negotiateSASL(msg, sasl)
+			}
+		case CmdError, ErrYoureBannedCreep:
+			return &RegistrationError{Nick: nick, Code: msg.Command, Reason: msg.Trailing()}
+		}
+
+		i.backlog = append(i.backlog, msg)
+	}
+}
@@ -0,0 +1,119 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/evan-buss/openbooks/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startRegistrationServer accepts a single connection and replies to every
+// NICK command with the reply returned by respond.
+func startRegistrationServer(t *testing.T, respond func(nick string) string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, "PING :3A5B12FF\r\n")
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "NICK ") {
+				fmt.Fprint(conn, respond(strings.TrimPrefix(line, "NICK "))+"\r\n")
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestRegisterNickInUse(t *testing.T) {
+	address := startRegistrationServer(t, func(nick string) string {
+		if nick == "evan_bot" {
+			return ":irc.irchighway.net 433 * evan_bot :Nickname is already in use."
+		}
+		return ":irc.irchighway.net 001 " + nick + " :Welcome to the IRC Highway IRC Network " + nick
+	})
+
+	conn := New("evan_bot", "OpenBooks")
+	require.NoError(t, conn.Connect(context.Background(), address, false))
+	defer conn.Close()
+
+	assert.Equal(t, "evan_bot1", conn.Username)
+
+	// The reader still receives the rejection and the welcome, but not the PING
+	msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, ErrNicknameInUse, msg.Command)
+	msg, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, RplWelcome, msg.Command)
+}
+
+func TestRegisterCustomStrategy(t *testing.T) {
+	address := startRegistrationServer(t, func(nick string) string {
+		if nick != "reader" {
+			return ":irc.irchighway.net 432 * " + nick + " :Erroneous Nickname"
+		}
+		return ":irc.irchighway.net 001 reader :Welcome"
+	})
+
+	conn := New("1nvalid", "OpenBooks")
+	conn.AlternateNick = func(string, int) string { return "reader" }
+	require.NoError(t, conn.Connect(context.Background(), address, false))
+	defer conn.Close()
+
+	assert.Equal(t, "reader", conn.Username)
+}
+
+func TestRegisterFailure(t *testing.T) {
+	address := startRegistrationServer(t, func(nick string) string {
+		return ":irc.irchighway.net 433 * " + nick + " :Nickname is already in use."
+	})
+
+	conn := New("evan_bot", "OpenBooks")
+	conn.MaxNickAttempts = 2
+	err := conn.Connect(context.Background(), address, false)
+
+	var regErr *RegistrationError
+	require.True(t, errors.As(err, &regErr))
+	assert.Equal(t, "evan_bot2", regErr.Nick)
+	assert.Equal(t, ErrNicknameInUse, regErr.Code)
+}
+
+// recordingDialer records the addresses it was asked to dial.
+type recordingDialer struct {
+	dialed []string
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	return proxy.Direct.DialContext(ctx, network, address)
+}
+
+func TestConnectUsesDialer(t *testing.T) {
+	address := startRegistrationServer(t, func(nick string) string {
+		return ":irc.irchighway.net 001 " + nick + " :Welcome"
+	})
+
+	dialer := &recordingDialer{}
+	conn := New("evan_bot", "OpenBooks")
+	conn.Dialer = dialer
+	require.NoError(t, conn.Connect(context.Background(), address, false))
+	defer conn.Close()
+
+	assert.Equal(t, []string{address}, dialer.dialed)
+}
@@ -0,0 +1,49 @@
+package irc
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/evan-buss/openbooks/util"
+)
+
+// TLSError is returned by Connect when the TLS handshake fails. Its message
+// explains why the server's certificate was rejected.
+type TLSError struct {
+	Address string
+	Err     error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("tls handshake with %s failed: %s", e.Address, e.Reason())
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// Reason describes the handshake failure in plain terms.
+func (e *TLSError) Reason() string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var pin *util.PinError
+
+	switch {
+	case errors.As(e.Err, &unknownAuthority):
+		reason := "the server's certificate is signed by an unknown authority. Trust its CA bundle, or skip verification and pin its key to connect"
+		if unknownAuthority.Cert != nil {
+			reason += fmt.Sprintf(" (key pin %s)", util.SPKIPin(unknownAuthority.Cert))
+		}
+		return reason
+	case errors.As(e.Err, &hostname):
+		return fmt.Sprintf("the server's certificate is not valid for %s", hostname.Host)
+	case errors.As(e.Err, &invalid) && invalid.Reason == x509.Expired:
+		return "the server's certificate has expired or is not yet valid"
+	case errors.As(e.Err, &pin):
+		return fmt.Sprintf("the server's certificate doesn't match any pinned key. It presented %s", pin.Pin)
+	default:
+		return e.Err.Error()
+	}
+}
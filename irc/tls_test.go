@@ -0,0 +1,155 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evan-buss/openbooks/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned creates a self-signed certificate for 127.0.0.1 and writes it
+// with its key to a PEM file.
+func selfSigned(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "irc.test.net"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(path, append(certPEM, keyPEM...), 0600))
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, path
+}
+
+// startTLSServer accepts TLS connections and welcomes every nickname. Client
+// certificates presented during the handshake are sent on the returned
+// channel.
+func startTLSServer(t *testing.T, cert tls.Certificate) (string, <-chan []*x509.Certificate) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	clientCerts := make(chan []*x509.Certificate, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tlsConn := conn.(*tls.Conn)
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				clientCerts <- tlsConn.ConnectionState().PeerCertificates
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if line := scanner.Text(); strings.HasPrefix(line, "NICK ") {
+						nick := strings.TrimPrefix(line, "NICK ")
+						fmt.Fprintf(conn, ":irc.test.net 001 %s :Welcome\r\n", nick)
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), clientCerts
+}
+
+func connectTLS(t *testing.T, address string, options util.TLSOptions) error {
+	config, err := options.Config()
+	require.NoError(t, err)
+
+	conn := New("evan_bot", "OpenBooks")
+	conn.TLSConfig = config
+	err = conn.Connect(context.Background(), address, true)
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+func TestTLSVerification(t *testing.T) {
+	cert, certFile := selfSigned(t)
+	address, _ := startTLSServer(t, cert)
+	pin := util.SPKIPin(cert.Leaf)
+
+	// Verification is on by default
+	conn := New("evan_bot", "OpenBooks")
+	err := conn.Connect(context.Background(), address, true)
+	var tlsErr *TLSError
+	require.True(t, errors.As(err, &tlsErr), "expected a TLSError, got %v", err)
+	assert.Contains(t, tlsErr.Error(), "unknown authority")
+	assert.Contains(t, tlsErr.Error(), pin)
+	assert.Contains(t, tlsErr.Error(), "skip verification and pin")
+
+	assert.NoError(t, connectTLS(t, address, util.TLSOptions{CAFile: certFile}))
+	assert.NoError(t, connectTLS(t, address, util.TLSOptions{Insecure: true}))
+	assert.NoError(t, connectTLS(t, address, util.TLSOptions{Insecure: true, Pins: []string{pin}}))
+	assert.NoError(t, connectTLS(t, address, util.TLSOptions{CAFile: certFile, Pins: []string{pin}}))
+
+	// Pinning alone doesn't skip chain verification
+	err = connectTLS(t, address, util.TLSOptions{Pins: []string{pin}})
+	assert.ErrorAs(t, err, &tlsErr)
+
+	other, _ := selfSigned(t)
+	err = connectTLS(t, address, util.TLSOptions{Insecure: true, Pins: []string{util.SPKIPin(other.Leaf)}})
+	assert.ErrorIs(t, err, util.ErrPinMismatch)
+	assert.Contains(t, err.Error(), pin)
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	serverCert, _ := selfSigned(t)
+	clientCert, clientFile := selfSigned(t)
+	address, clientCerts := startTLSServer(t, serverCert)
+
+	require.NoError(t, connectTLS(t, address, util.TLSOptions{Insecure: true, CertFile: clientFile}))
+
+	presented := <-clientCerts
+	require.Len(t, presented, 1)
+	assert.Equal(t, clientCert.Leaf.Raw, presented[0].Raw)
+}
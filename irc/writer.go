@@ -0,0 +1,186 @@
+package irc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/evan-buss/openbooks/util"
+)
+
+const (
+	// DefaultFloodBurst is the number of messages that can be sent back to
+	// back before flood control kicks in.
+	DefaultFloodBurst = 5
+	// DefaultFloodInterval is the time it takes to earn back one message
+	// once the burst is used up.
+	DefaultFloodInterval = 2 * time.Second
+
+	// maxMessageLength is the RFC 1459 limit including the trailing CRLF.
+	maxMessageLength = 512
+	// quitTimeout is how long Disconnect waits for QUIT to be written.
+	quitTimeout = time.Second
+)
+
+var ErrWriterClosed = errors.New("irc connection writer is closed")
+
+// outgoing is a single line waiting to be written to the server.
+type outgoing struct {
+	line []byte
+	// written receives the result of the write if it isn't nil
+	written chan<- error
+}
+
+// writer is the only goroutine allowed to write to the server connection.
+// Priority messages (PONG, registration and QUIT) skip the queue and the
+// flood limiter. Everything else is sent in order at the rate allowed by the
+// token bucket.
+type writer struct {
+	conn     net.Conn
+	normal   chan outgoing
+	priority chan outgoing
+	limiter  *util.TokenBucket
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func newWriter(conn net.Conn, burst int, interval time.Duration) *writer {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var rate float64
+	if interval > 0 {
+		rate = float64(time.Second) / float64(interval)
+	}
+
+	w := &writer{
+		conn:     conn,
+		normal:   make(chan outgoing, 64),
+		priority: make(chan outgoing, 16),
+		limiter:  util.NewTokenBucket(rate, burst),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go w.run()
+	return w
+}
+
+func (w *writer) run() {
+	defer w.cancel()
+
+	for {
+		// Always drain priority messages before looking at the normal queue
+		select {
+		case msg := <-w.priority:
+			if !w.write(msg) {
+				return
+			}
+			continue
+		default:
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case msg := <-w.priority:
+			if !w.write(msg) {
+				return
+			}
+		case msg := <-w.normal:
+			if !w.throttle() {
+				report(msg, ErrWriterClosed)
+				return
+			}
+			if !w.write(msg) {
+				return
+			}
+		}
+	}
+}
+
+// throttle waits until the flood limiter allows another message. Priority
+// messages are still written while waiting.
+func (w *writer) throttle() bool {
+	delay := w.limiter.Reserve(1)
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return false
+		case msg := <-w.priority:
+			if !w.write(msg) {
+				return false
+			}
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// write sends a single line and reports whether the writer can continue.
+// A failed write closes the connection so the reader notices as well.
+func (w *writer) write(msg outgoing) bool {
+	_, err := w.conn.Write(msg.line)
+	report(msg, err)
+	if err != nil {
+		w.conn.Close()
+		return false
+	}
+	return true
+}
+
+// enqueue hands a line to the writer goroutine. It blocks if the queue is
+// full and fails once the writer has stopped.
+func (w *writer) enqueue(queue chan outgoing, msg outgoing) error {
+	select {
+	case <-w.ctx.Done():
+		return ErrWriterClosed
+	case queue <- msg:
+		return nil
+	}
+}
+
+// stop shuts down the writer goroutine. Queued messages are discarded.
+func (w *writer) stop() {
+	w.cancel()
+}
+
+func report(msg outgoing, err error) {
+	if msg.written != nil {
+		msg.written <- err
+	}
+}
+
+// formatLine makes sure line is a single IRC message. Anything after an
+// embedded CR or LF is dropped so callers can't inject extra commands, and
+// the message is truncated to the protocol limit.
+func formatLine(line string) []byte {
+	if end := strings.IndexAny(line, "\r\n"); end != -1 {
+		line = line[:end]
+	}
+	if len(line) > maxMessageLength-2 {
+		line = line[:maxMessageLength-2]
+	}
+	return []byte(line + "\r\n")
+}
+
+// send queues a flood limited message.
+func (i *Conn) send(line string) {
+	if w := i.writer.Load(); w != nil {
+		w.enqueue(w.normal, outgoing{line: formatLine(line)})
+	}
+}
+
+// sendPriority queues a message that skips flood control.
+func (i *Conn) sendPriority(line string) {
+	if w := i.writer.Load(); w != nil {
+		w.enqueue(w.priority, outgoing{line: formatLine(line)})
+	}
+}
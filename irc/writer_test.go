@@ -0,0 +1,136 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatLine(t *testing.T) {
+	assert.Equal(t, "PRIVMSG #ebooks :hello\r\n", string(formatLine("PRIVMSG #ebooks :hello")))
+	assert.Equal(t, "PRIVMSG #ebooks :hello\r\n", string(formatLine("PRIVMSG #ebooks :hello\r\nQUIT :bye")))
+	assert.Equal(t, "PRIVMSG #ebooks :hello\r\n", string(formatLine("PRIVMSG #ebooks :hello\nQUIT :bye")))
+	assert.Len(t, formatLine("PRIVMSG #ebooks :"+strings.Repeat("a", 1000)), maxMessageLength)
+}
+
+// TestConcurrentWrites makes sure lines from many goroutines are never
+// interleaved with each other.
+func TestConcurrentWrites(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	conn.channel = "ebooks"
+	conn.writer.Load().stop()
+	conn.writer.Store(newWriter(conn.Conn, 1000, 0))
+	defer server.Close()
+
+	const senders = 50
+	received := make(chan []string)
+	go func() {
+		var lines []string
+		scanner := bufio.NewScanner(server)
+		for len(lines) < senders && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	var wg sync.WaitGroup
+	for n := 0; n < senders; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			conn.SendMessage(fmt.Sprintf("!Oatmeal book %d %s\r\nQUIT", n, strings.Repeat("x", 200)))
+		}(n)
+	}
+	wg.Wait()
+
+	lines := <-received
+	require.Len(t, lines, senders)
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, "PRIVMSG #ebooks :!Oatmeal book "), line)
+		assert.True(t, strings.HasSuffix(line, strings.Repeat("x", 200)), line)
+	}
+}
+
+// TestFloodControl makes sure messages past the burst are delayed but a
+// PONG is written right away.
+func TestFloodControl(t *testing.T) {
+	conn, server := pipeConn("evan_bot")
+	conn.channel = "ebooks"
+	conn.writer.Load().stop()
+	conn.writer.Store(newWriter(conn.Conn, 2, 200*time.Millisecond))
+	defer server.Close()
+
+	type line struct {
+		text string
+		at   time.Time
+	}
+	received := make(chan line, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			received <- line{scanner.Text(), time.Now()}
+		}
+	}()
+
+	start := time.Now()
+	for n := 1; n <= 4; n++ {
+		conn.SendMessage(fmt.Sprintf("message %d", n))
+	}
+	// Give the writer time to start waiting on the limiter
+	time.Sleep(50 * time.Millisecond)
+	conn.Pong("irc.irchighway.net")
+
+	var order []string
+	var last time.Time
+	for n := 0; n < 5; n++ {
+		select {
+		case l := <-received:
+			order = append(order, l.text)
+			last = l.at
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+
+	assert.Equal(t, []string{
+		"PRIVMSG #ebooks :message 1",
+		"PRIVMSG #ebooks :message 2",
+		"PONG irc.irchighway.net",
+		"PRIVMSG #ebooks :message 3",
+		"PRIVMSG #ebooks :message 4",
+	}, order)
+	assert.GreaterOrEqual(t, last.Sub(start), 350*time.Millisecond)
+}
+
+func TestDisconnectStopsWriter(t *testing.T) {
+	client, server := net.Pipe()
+	conn := New("evan_bot", "OpenBooks")
+	conn.Conn = client
+	conn.writer.Store(newWriter(client, conn.FloodBurst, conn.FloodInterval))
+
+	quit := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		quit <- line
+	}()
+
+	conn.Disconnect()
+	assert.Equal(t, "QUIT :Goodbye\r\n", <-quit)
+	assert.False(t, conn.IsConnected())
+
+	// Sending after disconnecting is a no-op rather than a panic or deadlock
+	conn.SendMessage("hello")
+
+	// A reconnect can't undo Disconnect
+	err := conn.Connect(context.Background(), "127.0.0.1:1", false)
+	assert.ErrorIs(t, err, ErrDisconnected)
+	assert.False(t, conn.IsConnected())
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -12,6 +13,17 @@ type DccServer struct {
 	Port   string
 	Reader io.ReadSeeker
 	log    *log.Logger
+
+	mu     sync.Mutex
+	offset int64
+}
+
+// Resume makes the next transfer start at position, like a sender that
+// accepted a DCC RESUME.
+func (dcc *DccServer) Resume(position int64) {
+	dcc.mu.Lock()
+	defer dcc.mu.Unlock()
+	dcc.offset = position
 }
 
 func (dcc *DccServer) Start(ready chan<- struct{}) {
@@ -33,6 +45,21 @@ func (dcc *DccServer) Start(ready chan<- struct{}) {
 	}
 }
 
+// Connect sends the file to a client listening on address, like a sender
+// answering the reply to a passive offer.
+func (dcc *DccServer) Connect(address string) {
+	if dcc.log == nil {
+		dcc.log = log.New(os.Stdout, "MOCK DCC: ", 0)
+	}
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		dcc.log.Println(err)
+		return
+	}
+	dcc.handler(conn)
+}
+
 func (dcc *DccServer) handler(conn net.Conn) {
 	defer func() {
 		dcc.Reader.Seek(0, io.SeekStart)
@@ -42,6 +69,12 @@ func (dcc *DccServer) handler(conn net.Conn) {
 
 	dcc.log.Println("Received a connection...")
 
+	dcc.mu.Lock()
+	offset := dcc.offset
+	dcc.offset = 0
+	dcc.mu.Unlock()
+	dcc.Reader.Seek(offset, io.SeekStart)
+
 	var err error
 	var n int
 	// n, err := io.Copy(conn, dcc.Reader)
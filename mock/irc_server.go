@@ -6,13 +6,19 @@ import (
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type IrcServer struct {
 	Port string
-	log  *log.Logger
+	// DCC servers by port. DCC RESUME requests for them are accepted.
+	DCC map[string]*DccServer
+	// DCC servers by passive offer token. They connect to clients that
+	// reply to the offer.
+	Passive map[string]*DccServer
+	log     *log.Logger
 }
 
 func (irc *IrcServer) Start(ready chan<- struct{}) {
@@ -38,8 +44,6 @@ func (irc *IrcServer) handler(conn net.Conn) {
 	irc.log.Printf("Connection received from %s", conn.RemoteAddr().String())
 	scanner := bufio.NewScanner(conn)
 
-	irc.serverHandler(conn)
-
 	irc.sendVersionRequest(conn)
 
 	for scanner.Scan() {
@@ -50,6 +54,25 @@ func (irc *IrcServer) handler(conn net.Conn) {
 
 		irc.log.Printf("Request Received: %s\n", request)
 
+		if strings.HasPrefix(request, "NICK ") {
+			nick := strings.TrimPrefix(request, "NICK ")
+			fmt.Fprintf(conn, ":irc.mock.net 001 %s :Welcome to the mock IRC network %s\r\n", nick, nick)
+		}
+
+		if strings.Contains(request, "\x01DCC RESUME ") {
+			irc.resumeHandler(request, conn)
+			continue
+		}
+
+		if strings.Contains(request, "\x01DCC SEND ") {
+			irc.passiveHandler(request)
+			continue
+		}
+
+		if strings.HasPrefix(request, "JOIN ") {
+			irc.serverHandler(conn)
+		}
+
 		if strings.Contains(request, "@search") {
 			go irc.searchHandler(request, conn)
 		}
@@ -64,22 +87,87 @@ func (irc *IrcServer) handler(conn net.Conn) {
 
 func (irc *IrcServer) sendVersionRequest(conn net.Conn) {
 	irc.log.Println("Sending CTCP Version inquiry.")
-	fmt.Fprintf(conn, ":mock_server PRIVMSG evan_28 :\x01VERSION\x01\r\n")
+	fmt.Fprintf(conn, ":mock_server!mock@irc.mock.net PRIVMSG evan_28 :\x01VERSION\x01\r\n")
 }
 
 func (irc *IrcServer) serverHandler(conn net.Conn) {
-	fmt.Fprintf(conn, "353 ~DV8 ~Horla +server1 ~server2 ~evan_irc\r\n")
-	fmt.Fprintf(conn, "end_list 366\r\n")
+	fmt.Fprintf(conn, ":evan_28!evan@irc.mock.net JOIN #ebooks\r\n")
+	fmt.Fprintf(conn, ":irc.mock.net 353 evan_28 = #ebooks :~DV8 ~Horla +server1 ~server2 ~evan_irc\r\n")
+	fmt.Fprintf(conn, ":irc.mock.net 366 evan_28 #ebooks :End of /NAMES list.\r\n")
 }
 
 func (irc *IrcServer) searchHandler(request string, conn net.Conn) {
 	irc.log.Printf("Sending search results.")
-	fmt.Fprint(conn, "NOTICE: Search returned 27 matches\r\n")
-	fmt.Fprint(conn, ":SearchOok!ook@only.ook PRIVMSG evan_28 :DCC SEND SearchOok_results_for__the_great_gatsby.txt.zip 2130706433 6668 1184\r\n")
+	bot := senderNick(request, "@")
+	fmt.Fprintf(conn, ":%s!ook@only.ook NOTICE evan_28 :Your search returned 27 matches\r\n", bot)
+	fmt.Fprintf(conn, ":%s!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND SearchOok_results_for__the_great_gatsby.txt.zip 2130706433 6668 1184\x01\r\n", bot)
 }
 
 func (irc *IrcServer) downloadHandler(request string, conn net.Conn) {
 	irc.log.Println("Sending book file.")
 	time.Sleep(time.Second * 4)
-	fmt.Fprint(conn, ":SearchOok!ook@only.ook PRIVMSG evan_28 :DCC SEND great-gatsby.epub 2130706433 6669 358887\r\n")
+	fmt.Fprintf(conn, ":%s!ook@only.ook PRIVMSG evan_28 :\x01DCC SEND great-gatsby.epub 2130706433 6669 358887\x01\r\n", senderNick(request, "!"))
+}
+
+// resumeHandler answers "PRIVMSG DV8 :\x01DCC RESUME file.epub 6669 1000\x01"
+// with a DCC ACCEPT if the port belongs to one of the DCC servers.
+func (irc *IrcServer) resumeHandler(request string, conn net.Conn) {
+	target := strings.Fields(request)[1]
+	_, params, _ := strings.Cut(request, "\x01DCC RESUME ")
+	fields := strings.Fields(strings.TrimSuffix(params, "\x01"))
+	if len(fields) < 3 {
+		return
+	}
+	port, position := fields[len(fields)-2], fields[len(fields)-1]
+
+	dcc, ok := irc.DCC[port]
+	if !ok {
+		irc.log.Printf("Ignoring resume for unknown port %s.\n", port)
+		return
+	}
+	offset, err := strconv.ParseInt(position, 10, 64)
+	if err != nil {
+		return
+	}
+
+	irc.log.Printf("Resuming transfer on port %s at %d.\n", port, offset)
+	dcc.Resume(offset)
+	fmt.Fprintf(conn, ":%s!ook@only.ook PRIVMSG evan_28 :\x01DCC ACCEPT file.ext %s %d\x01\r\n", target, port, offset)
+}
+
+// passiveHandler connects to a client that replied to a passive offer with
+// "PRIVMSG DV8 :\x01DCC SEND file.epub 2130706433 50000 1000 42\x01".
+func (irc *IrcServer) passiveHandler(request string) {
+	_, params, _ := strings.Cut(request, "\x01DCC SEND ")
+	fields := strings.Fields(strings.TrimSuffix(params, "\x01"))
+	if len(fields) < 5 {
+		return
+	}
+	ip, port, token := fields[len(fields)-4], fields[len(fields)-3], fields[len(fields)-1]
+
+	dcc, ok := irc.Passive[token]
+	if !ok {
+		irc.log.Printf("Ignoring passive reply with unknown token %s.\n", token)
+		return
+	}
+
+	// IPv4 addresses are sent as an integer
+	if n, err := strconv.ParseUint(ip, 10, 32); err == nil {
+		ip = net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).String()
+	}
+
+	irc.log.Printf("Connecting to passive DCC client at %s:%s.\n", ip, port)
+	go dcc.Connect(net.JoinHostPort(ip, port))
+}
+
+// senderNick returns the bot named after marker in a request like
+// "PRIVMSG #ebooks :!DV8 Great Gatsby.epub" so replies come from the nick
+// the client asked.
+func senderNick(request, marker string) string {
+	_, text, _ := strings.Cut(request, ":"+marker)
+	nick, _, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if nick == "" {
+		return "SearchOok"
+	}
+	return nick
 }
@@ -0,0 +1,156 @@
+package mock
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Socks5Server is a minimal SOCKS5 proxy that supports the CONNECT command
+// with optional username / password authentication.
+type Socks5Server struct {
+	Port     string
+	Username string
+	Password string
+	log      *log.Logger
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func (socks *Socks5Server) Start(ready chan<- struct{}) {
+	socks.log = log.New(os.Stdout, "MOCK SOCKS5: ", 0)
+
+	server, err := net.Listen("tcp", socks.Port)
+	if err != nil {
+		panic(err)
+	}
+	socks.log.Println("Listening on " + socks.Port)
+	ready <- struct{}{}
+
+	for {
+		conn, err := server.Accept()
+		if err != nil {
+			panic(err)
+		}
+		go socks.handler(conn)
+	}
+}
+
+// Targets returns the addresses clients asked the proxy to connect to.
+func (socks *Socks5Server) Targets() []string {
+	socks.mu.Lock()
+	defer socks.mu.Unlock()
+	return append([]string(nil), socks.targets...)
+}
+
+func (socks *Socks5Server) handler(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	if socks.Username != "" {
+		conn.Write([]byte{0x05, 0x02})
+		if !socks.authenticate(conn) {
+			socks.log.Println("rejected credentials")
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	} else {
+		conn.Write([]byte{0x05, 0x00})
+	}
+
+	target, ok := socks.readTarget(conn)
+	if !ok {
+		return
+	}
+
+	socks.mu.Lock()
+	socks.targets = append(socks.targets, target)
+	socks.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		socks.log.Println(err)
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	socks.log.Println("Proxying connection to " + target)
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (socks *Socks5Server) authenticate(conn net.Conn) bool {
+	read := func() string {
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return ""
+		}
+		value := make([]byte, length[0])
+		io.ReadFull(conn, value)
+		return string(value)
+	}
+
+	version := make([]byte, 1)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return false
+	}
+	username := read()
+	password := read()
+	return username == socks.Username && password == socks.Password
+}
+
+func (socks *Socks5Server) readTarget(conn net.Conn) (string, bool) {
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", false
+	}
+
+	var host string
+	switch request[3] {
+	case 0x01, 0x04:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == 0x04 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", false
+		}
+		host = ip.String()
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", false
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", false
+		}
+		host = string(name)
+	default:
+		return "", false
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", false
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// HTTPConnect dials TCP connections through an HTTP proxy using the CONNECT
+// method.
+type HTTPConnect struct {
+	Address  string
+	Username string
+	Password string
+	// Forward is used to connect to the proxy itself.
+	Forward Dialer
+}
+
+// DialContext connects to address through the proxy.
+func (h *HTTPConnect) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("http proxy: network %s not supported", network)
+	}
+
+	forward := h.Forward
+	if forward == nil {
+		forward = Direct
+	}
+
+	conn, err := forward.DialContext(ctx, "tcp", h.Address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach http proxy %s: %w", h.Address, err)
+	}
+
+	var reader *bufio.Reader
+	err = handshake(ctx, conn, func() error {
+		var err error
+		reader, err = h.connect(conn, address)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s: %w", h.Address, err)
+	}
+
+	// IRC servers talk first, so the reader may already hold data that
+	// arrived right after the proxy's response.
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+func (h *HTTPConnect) connect(conn net.Conn, address string) (*bufio.Reader, error) {
+	request := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", address, address)
+	if h.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(h.Username + ":" + h.Password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	request += "\r\n"
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("connect to %s failed: %s", address, resp.Status)
+	}
+
+	return reader, nil
+}
+
+// bufferedConn reads any data buffered during the proxy handshake before
+// reading from the connection itself.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
@@ -0,0 +1,109 @@
+// Package proxy provides dialers used for both the IRC control connection and
+// DCC transfers, so they can optionally be routed through a SOCKS5 or HTTP
+// CONNECT proxy.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+var ErrUnsupportedScheme = errors.New("unsupported proxy scheme. use socks5, socks5h or http")
+
+// Dialer opens network connections, either directly or through a proxy.
+// *net.Dialer satisfies this interface.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Direct connects to the address without a proxy.
+var Direct Dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// FromURL returns a Dialer for the given proxy URL. An empty string returns
+// Direct. Supported formats:
+//
+//	socks5://[user:password@]host:port   (hostnames are resolved locally)
+//	socks5h://[user:password@]host:port  (hostnames are resolved by the proxy)
+//	http://[user:password@]host:port     (HTTP CONNECT)
+func FromURL(raw string) (Dialer, error) {
+	if raw == "" {
+		return Direct, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: missing host", raw)
+	}
+
+	var username, password string
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return &SOCKS5{
+			Address:   withDefaultPort(u, "1080"),
+			Username:  username,
+			Password:  password,
+			RemoteDNS: u.Scheme == "socks5h",
+			Forward:   Direct,
+		}, nil
+	case "http":
+		return &HTTPConnect{
+			Address:  withDefaultPort(u, "80"),
+			Username: username,
+			Password: password,
+			Forward:  Direct,
+		}, nil
+	default:
+		return nil, ErrUnsupportedScheme
+	}
+}
+
+func withDefaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// handshake runs fn with the connection deadline tied to ctx, so a proxy
+// that never answers can't block forever.
+func handshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock any pending reads or writes
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	err := fn()
+	// The connection deadline can fire just before ctx notices its own, wait
+	// for it so callers always get the context's error
+	if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		<-ctx.Done()
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 protocol constants. See RFC 1928 and RFC 1929.
+const (
+	socksVersion      = 0x05
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksConnect      = 0x01
+	socksIPv4         = 0x01
+	socksDomain       = 0x03
+	socksIPv6         = 0x04
+)
+
+var (
+	ErrSOCKSAuth     = errors.New("socks5 proxy rejected the username or password")
+	ErrSOCKSMethod   = errors.New("socks5 proxy doesn't support any offered authentication method")
+	ErrSOCKSResponse = errors.New("malformed socks5 proxy response")
+)
+
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// SOCKS5 dials TCP connections through a SOCKS5 proxy.
+type SOCKS5 struct {
+	Address  string
+	Username string
+	Password string
+	// RemoteDNS sends hostnames to the proxy instead of resolving them
+	// locally (socks5h).
+	RemoteDNS bool
+	// Forward is used to connect to the proxy itself.
+	Forward Dialer
+}
+
+// DialContext connects to address through the proxy.
+func (s *SOCKS5) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: network %s not supported", network)
+	}
+
+	forward := s.Forward
+	if forward == nil {
+		forward = Direct
+	}
+
+	conn, err := forward.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach socks5 proxy %s: %w", s.Address, err)
+	}
+
+	err = handshake(ctx, conn, func() error { return s.connect(ctx, conn, address) })
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy %s: %w", s.Address, err)
+	}
+
+	return conn, nil
+}
+
+func (s *SOCKS5) connect(ctx context.Context, conn net.Conn, address string) error {
+	if err := s.authenticate(conn); err != nil {
+		return err
+	}
+
+	request, err := s.connectRequest(ctx, address)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	// VER REP RSV ATYP
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion {
+		return ErrSOCKSResponse
+	}
+	if header[1] != 0x00 {
+		reason, ok := socksReplies[header[1]]
+		if !ok {
+			reason = fmt.Sprintf("unknown error %#x", header[1])
+		}
+		return fmt.Errorf("connect to %s failed: %s", address, reason)
+	}
+
+	// Discard the bound address, we don't need it.
+	var skip int
+	switch header[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return ErrSOCKSResponse
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+func (s *SOCKS5) authenticate(conn net.Conn) error {
+	methods := []byte{socksAuthNone}
+	if s.Username != "" {
+		methods = []byte{socksAuthNone, socksAuthPassword}
+	}
+
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return ErrSOCKSResponse
+	}
+
+	switch reply[1] {
+	case socksAuthNone:
+		return nil
+	case socksAuthPassword:
+		if s.Username == "" {
+			return ErrSOCKSMethod
+		}
+		if len(s.Username) > 255 || len(s.Password) > 255 {
+			return errors.New("socks5 username and password must be 255 bytes or less")
+		}
+		auth := []byte{0x01, byte(len(s.Username))}
+		auth = append(auth, s.Username...)
+		auth = append(auth, byte(len(s.Password)))
+		auth = append(auth, s.Password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return ErrSOCKSAuth
+		}
+		return nil
+	default:
+		return ErrSOCKSMethod
+	}
+}
+
+// connectRequest builds the CONNECT request for address.
+func (s *SOCKS5) connectRequest(ctx context.Context, address string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	request := []byte{socksVersion, socksConnect, 0x00}
+
+	ip := net.ParseIP(host)
+	if ip == nil && !s.RemoteDNS {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0]
+	}
+
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return nil, fmt.Errorf("hostname %q is too long", host)
+		}
+		request = append(request, socksDomain, byte(len(host)))
+		request = append(request, host...)
+	case ip.To4() != nil:
+		request = append(request, socksIPv4)
+		request = append(request, ip.To4()...)
+	default:
+		request = append(request, socksIPv6)
+		request = append(request, ip.To16()...)
+	}
+
+	return binary.BigEndian.AppendUint16(request, uint16(port)), nil
+}
@@ -30,11 +30,13 @@ export interface Response extends Omit<Notification, "timestamp"> {
 // ConnectionResponse is received after successful IRC connection
 export interface ConnectionResponse extends Response {
   name: string;
+  server: string;
 }
 
 // SearchResponse is received after search results are received and parsed.
 export interface SearchResponse extends Response {
   books: BookDetail[];
+  groups: BookGroup[];
   errors: ParseError[];
 }
 
@@ -50,9 +52,35 @@ export interface BookDetail {
   title: string;
   format: string;
   size: string;
+  bytes: number;
+  hash: string;
+  tags: BookTags;
   full: string;
 }
 
+// BookTags are the bracketed notes taken out of a title, like "(retail)".
+export interface BookTags {
+  retail?: boolean;
+  version?: string;
+  series?: string;
+  number?: string;
+  year?: string;
+  other?: string[];
+}
+
+// Mirror is one server's copy of a book in a BookGroup.
+export interface Mirror extends BookDetail {
+  online: boolean;
+}
+
+// BookGroup is one book offered by several servers, best mirror first.
+export interface BookGroup {
+  author: string;
+  title: string;
+  format: string;
+  mirrors: Mirror[];
+}
+
 export interface ParseError {
   error: string;
   line: string;
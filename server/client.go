@@ -3,8 +3,11 @@ package server
 import (
 	"context"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/evan-buss/openbooks/core"
 	"github.com/evan-buss/openbooks/irc"
 	"github.com/google/uuid"
 
@@ -25,6 +28,25 @@ const (
 	maxMessageSize = 512
 )
 
+// connectionState describes the IRC connection of a client.
+type connectionState string
+
+const (
+	stateConnected    connectionState = "connected"
+	stateReconnecting connectionState = "reconnecting"
+	stateDown         connectionState = "down"
+)
+
+// connectionState returns the state of the IRC connection. A connection
+// closed with Disconnect is down whatever the last event was.
+func (c *Client) connectionState() connectionState {
+	state, ok := c.state.Load().(connectionState)
+	if !ok || !c.irc.IsConnected() {
+		return stateDown
+	}
+	return state
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -47,10 +69,36 @@ type Client struct {
 	// Individual IRC connection per connected client.
 	irc *irc.Conn
 
+	// Outstanding searches and downloads, used to match DCC offers to the
+	// request that caused them.
+	requests *core.RequestTracker
+
+	// Decides which DCC offers are downloaded.
+	offers *core.OfferPolicy
+
+	// Saves DCC offers and resumes interrupted transfers.
+	downloader *core.Downloader
+
+	// Send to Kindle requests waiting for their book, keyed by request ID.
+	kindle sync.Map
+
+	// The latest search results sent to the browser, keyed by their full
+	// book line. Downloads are verified against the size and hash they
+	// advertise. Each search replaces them.
+	resultsMu sync.Mutex
+	results   map[string]core.BookDetail
+
+	// State of the IRC connection, a connectionState. Set by the
+	// connection event handlers.
+	state atomic.Value
+
 	log *log.Logger
 
 	// Context is used to signal when this client should close.
 	ctx context.Context
+
+	// cancel closes ctx. Called by the hub when the client is unregistered.
+	cancel context.CancelFunc
 }
 
 // readPump pumps messages from the websocket connection to the hub.
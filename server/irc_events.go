@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,23 +11,39 @@ import (
 
 func (server *server) NewIrcEventHandler(client *Client) core.EventHandler {
 	handler := core.EventHandler{}
-	handler[core.SearchResult] = client.searchResultHandler(server.config.DownloadDir)
-	handler[core.BookResult] = client.bookResultHandler(server.config.DownloadDir, server.config.DisableBrowserDownloads)
+	handler[core.SearchResult] = client.offers.Filter(client.searchResultHandler(server), client.offerRejectedHandler)
+	handler[core.BookResult] = client.offers.Filter(client.bookResultHandler(server), client.offerRejectedHandler)
 	handler[core.NoResults] = client.noResultsHandler
 	handler[core.BadServer] = client.badServerHandler
 	handler[core.SearchAccepted] = client.searchAcceptedHandler
 	handler[core.MatchesFound] = client.matchesFoundHandler
+	handler[core.DCCAccept] = client.downloader.Accept
 	handler[core.Ping] = client.pingHandler
 	handler[core.ServerList] = client.userListHandler(server.repository)
-	handler[core.Version] = client.versionHandler(server.config.UserAgent)
+	handler[core.CTCPQuery] = client.ctcpHandler(core.CTCPResponder{Version: server.config.UserAgent})
+	handler[core.UnknownCTCP] = client.unknownCTCPHandler
+	handler[core.Disconnected] = client.disconnectedHandler
+	handler[core.Reconnecting] = client.reconnectingHandler
+	handler[core.Reconnected] = client.reconnectedHandler
+	handler[core.ReconnectFailed] = client.reconnectFailedHandler
+	handler[core.AuthSucceeded] = client.authSucceededHandler
+	handler[core.AuthFailed] = client.authFailedHandler
 	return handler
 }
 
 // searchResultHandler downloads from DCC server, parses data, and sends data to client
-func (c *Client) searchResultHandler(downloadDir string) core.HandlerFunc {
-	return func(text string) {
-		extractedPath, err := core.DownloadExtractDCCString(filepath.Join(downloadDir, "books"), text, nil)
-		if err != nil {
+func (c *Client) searchResultHandler(server *server) core.OfferHandlerFunc {
+	return func(req *core.Request, text string) {
+		if req != nil {
+			c.log.Printf("Received results for search %q (%s).\n", req.Query, req.ID)
+		}
+
+		extractedPath, err := c.downloader.Download(c.ctx, c.irc, req, filepath.Join(server.config.DownloadDir, "books"), text, nil)
+		var integrityErr *core.IntegrityError
+		if errors.As(err, &integrityErr) {
+			// Parse what arrived. Missing results are better than none.
+			c.log.Println(err)
+		} else if err != nil {
 			c.log.Println(err)
 			c.send <- newErrorResponse("Error when downloading search results.")
 			return
@@ -52,8 +69,21 @@ func (c *Client) searchResultHandler(downloadDir string) core.HandlerFunc {
 			}
 		}
 
+		query := ""
+		if req != nil {
+			query = req.Query
+		}
+		core.RankBooks(bookResults, query, server.repository.Servers().ElevatedUsers)
+
 		c.log.Printf("Sending %d search results.\n", len(bookResults))
-		c.send <- newSearchResponse(bookResults, parseErrors)
+		results := make(map[string]core.BookDetail, len(bookResults))
+		for _, book := range bookResults {
+			results[book.Full] = book
+		}
+		c.resultsMu.Lock()
+		c.results = results
+		c.resultsMu.Unlock()
+		c.send <- newSearchResponse(bookResults, parseErrors, server.repository.Servers().ElevatedUsers)
 
 		err = os.Remove(extractedPath)
 		if err != nil {
@@ -62,21 +92,61 @@ func (c *Client) searchResultHandler(downloadDir string) core.HandlerFunc {
 	}
 }
 
-// bookResultHandler downloads the book file and sends it over the websocket
-func (c *Client) bookResultHandler(downloadDir string, disableBrowserDownloads bool) core.HandlerFunc {
-	return func(text string) {
-		extractedPath, err := core.DownloadExtractDCCString(filepath.Join(downloadDir, "books"), text, nil)
-		if err != nil {
+// bookResultHandler downloads the book file and sends it over the websocket,
+// or emails it if it answers a Send to Kindle request
+func (c *Client) bookResultHandler(server *server) core.OfferHandlerFunc {
+	return func(req *core.Request, text string) {
+		var kindle *SendToKindleRequest
+		if req != nil {
+			c.log.Printf("Received book for request %s: %s\n", req.ID, req.Query)
+			if pending, ok := c.kindle.LoadAndDelete(req.ID); ok {
+				kindle = pending.(*SendToKindleRequest)
+			}
+		}
+
+		if server.transfers.Busy() {
+			c.send <- newStatusResponse(NOTIFY, "Download queued. It starts when another transfer finishes.")
+		}
+
+		extractedPath, err := c.downloader.Download(c.ctx, c.irc, req, filepath.Join(server.config.DownloadDir, "books"), text, nil)
+		var integrityErr *core.IntegrityError
+		if errors.As(err, &integrityErr) {
+			c.log.Println(err)
+			response := newStatusResponse(WARNING, "The downloaded book may be corrupt.")
+			response.Detail = integrityErr.Error()
+			c.send <- response
+		} else if err != nil {
 			c.log.Println(err)
 			c.send <- newErrorResponse("Error when downloading book.")
 			return
 		}
 
+		if kindle != nil {
+			c.emailBook(server, kindle, extractedPath)
+			return
+		}
+
 		c.log.Printf("Sending book entitled '%s'.\n", filepath.Base(extractedPath))
-		c.send <- newDownloadResponse(extractedPath, disableBrowserDownloads)
+		c.send <- newDownloadResponse(extractedPath, server.config.DisableBrowserDownloads)
 	}
 }
 
+// offerRejectedHandler is called for DCC offers the offer policy turned
+// down. Only rejected answers to the client's own requests are shown.
+func (c *Client) offerRejectedHandler(req *core.Request, text string, err error) {
+	c.log.Println(err)
+	if req == nil {
+		return
+	}
+
+	c.kindle.Delete(req.ID)
+	response := newErrorResponse("Download rejected.")
+	if errors.Is(err, core.ErrOfferTooLarge) {
+		response.Detail = "The file is larger than the maximum file size."
+	}
+	c.send <- response
+}
+
 // NoResults is called when the server returns that nothing was found for the query
 func (c *Client) noResultsHandler(_ string) {
 	c.send <- newErrorResponse("No results found for the query.")
@@ -101,15 +171,67 @@ func (c *Client) pingHandler(serverUrl string) {
 	c.irc.Pong(serverUrl)
 }
 
-func (c *Client) versionHandler(version string) core.HandlerFunc {
+func (c *Client) ctcpHandler(responder core.CTCPResponder) core.HandlerFunc {
 	return func(line string) {
-		c.log.Printf("Sending CTCP version response: %s", line)
-		core.SendVersionInfo(c.irc, line, version)
+		c.log.Printf("Answering CTCP query: %s", line)
+		if err := responder.Respond(c.irc, line); err != nil {
+			c.log.Println(err)
+		}
+	}
+}
+
+func (c *Client) unknownCTCPHandler(line string) {
+	c.log.Printf("Ignoring unsupported CTCP query: %s", line)
+}
+
+// disconnectedHandler is called when the IRC connection drops unexpectedly
+func (c *Client) disconnectedHandler(reason string) {
+	c.log.Printf("IRC connection lost: %s\n", reason)
+	c.state.Store(stateReconnecting)
+	c.send <- newStatusResponse(WARNING, "Connection to the IRC server was lost.")
+}
+
+// reconnectingHandler is called before each reconnect attempt
+func (c *Client) reconnectingHandler(delay string) {
+	c.log.Printf("Reconnecting to IRC server in %s.\n", delay)
+	c.send <- newStatusResponse(NOTIFY, fmt.Sprintf("Reconnecting to the IRC server in %s.", delay))
+}
+
+// reconnectedHandler is called once the connection has been re-established
+func (c *Client) reconnectedHandler(address string) {
+	c.log.Printf("Reconnected to %s.\n", address)
+	c.state.Store(stateConnected)
+	c.send <- newStatusResponse(SUCCESS, "Reconnected to the IRC server.")
+}
+
+// reconnectFailedHandler is called when all reconnect attempts have failed
+func (c *Client) reconnectFailedHandler(reason string) {
+	c.log.Printf("Unable to reconnect to IRC server: %s\n", reason)
+	c.state.Store(stateDown)
+	c.send <- newErrorResponse("Unable to reconnect to the IRC server. Refresh the page to try again.")
+}
+
+// authSucceededHandler is called when SASL or NickServ accepts our credentials
+func (c *Client) authSucceededHandler(detail string) {
+	c.log.Printf("IRC authentication succeeded: %s\n", detail)
+	c.send <- newStatusResponse(SUCCESS, fmt.Sprintf("Identified as %s.", c.irc.Username))
+}
+
+// authFailedHandler is called when SASL or NickServ rejects our credentials
+func (c *Client) authFailedHandler(reason string) {
+	c.log.Printf("IRC authentication failed: %s\n", reason)
+	c.send <- StatusResponse{
+		MessageType:      STATUS,
+		NotificationType: DANGER,
+		Title:            "IRC authentication failed.",
+		Detail:           reason,
 	}
 }
 
 func (c *Client) userListHandler(repo *Repository) core.HandlerFunc {
 	return func(text string) {
-		repo.servers = core.ParseServers(text)
+		servers := core.ParseServers(text)
+		repo.SetServers(servers)
+		c.offers.SetElevatedUsers(servers.ElevatedUsers)
 	}
 }
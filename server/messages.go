@@ -68,13 +68,16 @@ type SendToKindleRequest struct {
 // ConnectionResponse
 type ConnectionResponse struct {
 	StatusResponse
-	Name string `json:"name"`
+	Name   string `json:"name"`
+	Server string `json:"server"`
 }
 
 // SearchResponse is a response that is sent containing BookDetails objects that matched the query
 type SearchResponse struct {
 	StatusResponse
-	Books  []core.BookDetail `json:"books"`
+	Books []core.BookDetail `json:"books"`
+	// Groups are the books with results from several servers merged
+	Groups []core.BookGroup  `json:"groups"`
 	Errors []core.ParseError `json:"errors"`
 }
 
@@ -100,7 +103,7 @@ func newRateLimitResponse(remainingSeconds float64) StatusResponse {
 	}
 }
 
-func newSearchResponse(results []core.BookDetail, errors []core.ParseError) SearchResponse {
+func newSearchResponse(results []core.BookDetail, errors []core.ParseError, online []string) SearchResponse {
 	detail := fmt.Sprintf("There were %v parsing errors.", len(errors))
 	if len(errors) == 1 {
 		detail = "There was 1 parsing error."
@@ -113,6 +116,7 @@ func newSearchResponse(results []core.BookDetail, errors []core.ParseError) Sear
 			Detail:           detail,
 		},
 		Books:  results,
+		Groups: core.GroupBooks(results, online),
 		Errors: errors,
 	}
 }
@@ -1,11 +1,31 @@
 package server
 
-import "github.com/evan-buss/openbooks/core"
+import (
+	"sync"
+
+	"github.com/evan-buss/openbooks/core"
+)
 
 type Repository struct {
+	mu      sync.RWMutex
 	servers core.IrcServers
 }
 
 func NewRepository() *Repository {
 	return &Repository{servers: core.IrcServers{}}
 }
+
+// Servers returns the last list of IRC servers.
+func (r *Repository) Servers() core.IrcServers {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.servers
+}
+
+// SetServers replaces the list of IRC servers. It is updated by the IRC
+// reader while search results and HTTP handlers read it.
+func (r *Repository) SetServers(servers core.IrcServers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.servers = servers
+}
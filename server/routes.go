@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/evan-buss/openbooks/core"
 	"github.com/evan-buss/openbooks/irc"
 	"io/fs"
 	"log"
@@ -114,15 +115,40 @@ func (server *server) serveWs() http.HandlerFunc {
 			return
 		}
 
-		randomUsername := generateRandomUsername(server.config.UserName)
-
+		// Registered nicknames are used as is, otherwise every client gets a
+		// random name.
+		randomUsername := server.config.UserName
+		if server.config.Password == "" {
+			randomUsername = generateRandomUsername(server.config.UserName)
+		}
+		ircConn := irc.New(randomUsername, server.config.UserAgent)
+		ircConn.AlternateNick = func(string, int) string {
+			return generateRandomUsername(server.config.UserName)
+		}
+		ircConn.Account = server.config.Account
+		ircConn.Password = server.config.Password
+		ircConn.SASL = server.config.EnableSASL
+		ircConn.Dialer = server.dialer
+		ircConn.TLSConfig = server.tlsConfig
+		ircConn.PingTimeout = server.config.PingTimeout
+
+		requests := core.NewRequestTracker()
+		downloader := core.NewDownloader(server.dialer)
+		downloader.Passive = server.config.Passive
+		downloader.Transfers = server.transfers
+		downloader.TLSConfig = server.dccTLSConfig
+		ctx, cancel := context.WithCancel(context.Background())
 		client := &Client{
-			conn: conn,
-			send: make(chan interface{}, 128),
-			uuid: userId,
-			irc:  irc.New(randomUsername, server.config.UserAgent),
-			log:  log.New(os.Stdout, fmt.Sprintf("CLIENT (%s): ", randomUsername), log.LstdFlags|log.Lmsgprefix),
-			ctx:  context.Background(),
+			conn:       conn,
+			send:       make(chan interface{}, 128),
+			uuid:       userId,
+			irc:        ircConn,
+			requests:   requests,
+			offers:     core.NewOfferPolicy(requests, server.config.MaxFileSize),
+			downloader: downloader,
+			log:        log.New(os.Stdout, fmt.Sprintf("CLIENT (%s): ", randomUsername), log.LstdFlags|log.Lmsgprefix),
+			ctx:        ctx,
+			cancel:     cancel,
 		}
 
 		server.log.Printf("Client connected from %s\n", conn.RemoteAddr().String())
@@ -148,19 +174,31 @@ func (server *server) staticFilesHandler(assetPath string) http.Handler {
 
 func (server *server) statsHandler() http.HandlerFunc {
 	type statsReponse struct {
-		UUID string `json:"uuid"`
-		IP   string `json:"ip"`
-		Name string `json:"name"`
+		UUID      string `json:"uuid"`
+		IP        string `json:"ip"`
+		Name      string `json:"name"`
+		Connected bool   `json:"connected"`
+		// State is "connected", "reconnecting" or "down"
+		State string `json:"state"`
+		// Round trip time of the last keepalive PING in milliseconds. Zero
+		// when not connected.
+		Lag int64 `json:"lag"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		result := make([]statsReponse, 0, len(server.clients))
 
 		for _, client := range server.clients {
+			state := client.connectionState()
 			details := statsReponse{
-				UUID: client.uuid.String(),
-				Name: client.irc.Username,
-				IP:   client.conn.RemoteAddr().String(),
+				UUID:      client.uuid.String(),
+				Name:      client.irc.Username,
+				IP:        client.conn.RemoteAddr().String(),
+				Connected: state == stateConnected,
+				State:     string(state),
+			}
+			if state == stateConnected {
+				details.Lag = client.irc.Lag().Milliseconds()
 			}
 
 			result = append(result, details)
@@ -172,7 +210,7 @@ func (server *server) statsHandler() http.HandlerFunc {
 
 func (server *server) serverListHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(server.repository.servers)
+		json.NewEncoder(w).Encode(server.repository.Servers())
 	}
 }
 
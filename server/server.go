@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"math/rand"
@@ -13,6 +14,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/evan-buss/openbooks/core"
+	"github.com/evan-buss/openbooks/dcc"
+	"github.com/evan-buss/openbooks/proxy"
+	"github.com/evan-buss/openbooks/util"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
@@ -45,6 +50,22 @@ type server struct {
 
 	// The time the last search was performed. Used to rate limit searches.
 	lastSearch time.Time
+
+	// Dialer used for IRC and DCC connections. Set from Config.Proxy.
+	dialer proxy.Dialer
+
+	// TLS settings for the IRC connection. Set from Config.TLS.
+	tlsConfig *tls.Config
+
+	// TLS settings for DCC SSEND transfers. Set from Config.DCCTLS.
+	dccTLSConfig *tls.Config
+
+	// IRC servers shared by every client. Remembers the last server that
+	// worked.
+	session *core.Session
+
+	// Limits DCC transfers of every client. Set from Config.Transfers.
+	transfers *dcc.Manager
 }
 
 // Config contains settings for server
@@ -52,11 +73,21 @@ type Config struct {
 	Log                     bool
 	Port                    string
 	UserName                string
+	Account                 string
+	Password                string
+	EnableSASL              bool
 	Persist                 bool
 	DownloadDir             string
 	Basepath                string
-	Server                  string
+	Servers                 []string
 	EnableTLS               bool
+	Proxy                   string
+	TLS                     util.TLSOptions
+	DCCTLS                  util.TLSOptions // Verifies DCC SSEND senders, separate from the IRC connection
+	PingTimeout             time.Duration
+	MaxFileSize             int64 // Largest unrequested DCC offer to accept in bytes. Zero disables the limit.
+	Passive                 dcc.PassiveOptions
+	Transfers               dcc.Limits // Bandwidth and concurrency limits shared by all clients
 	SearchTimeout           time.Duration
 	SearchBot               string
 	DisableBrowserDownloads bool
@@ -78,6 +109,7 @@ func New(config Config) *server {
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
 		clients:     make(map[uuid.UUID]*Client),
+		transfers:   dcc.NewManager(config.Transfers),
 		log:         log.New(os.Stdout, "SERVER: ", log.LstdFlags|log.Lmsgprefix),
 	}
 }
@@ -101,7 +133,38 @@ func Start(config Config) {
 	}
 	router.Use(cors.New(corsConfig).Handler)
 
+	dialer, err := proxy.FromURL(config.Proxy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tlsConfig, err := config.TLS.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Bots use self-signed certificates, so a matching pin is enough
+	dccTLS := config.DCCTLS
+	dccTLS.TrustPins = true
+	dccTLSConfig, err := dccTLS.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoints, err := core.ParseEndpoints(config.Servers, config.EnableTLS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := config.Passive.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
 	server := New(config)
+	server.dialer = dialer
+	server.tlsConfig = tlsConfig
+	server.dccTLSConfig = dccTLSConfig
+	server.session = core.NewSession(endpoints, core.DefaultBackoff)
 	routes := server.registerRoutes()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -125,16 +188,14 @@ func (server *server) startClientHub(ctx context.Context) {
 			server.clients[client.uuid] = client
 		case client := <-server.unregister:
 			if _, ok := server.clients[client.uuid]; ok {
-				_, cancel := context.WithCancel(client.ctx)
+				client.cancel()
 				close(client.send)
-				cancel()
 				delete(server.clients, client.uuid)
 			}
 		case <-ctx.Done():
 			for _, client := range server.clients {
-				_, cancel := context.WithCancel(client.ctx)
+				client.cancel()
 				close(client.send)
-				cancel()
 				delete(server.clients, client.uuid)
 			}
 			return
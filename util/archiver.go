@@ -30,6 +30,10 @@ func ExtractArchive(archivePath string) (string, error) {
 
 	var newPath string
 	err = w.Walk(archivePath, func(f archiver.File) error {
+		if f.IsDir() {
+			return nil
+		}
+
 		// Extract only one file per archive. Otherwise, stop walking,
 		// remove extracted items, and deliver the archive itself.
 		if newPath != "" {
@@ -41,7 +45,12 @@ func ExtractArchive(archivePath string) (string, error) {
 			return archiver.ErrStopWalk
 		}
 
-		newPath = filepath.Join(filepath.Dir(archivePath), f.Name()+".temp")
+		// Entry names are chosen by whoever built the archive
+		path, err := UniquePath(filepath.Dir(archivePath), f.Name())
+		if err != nil {
+			return err
+		}
+		newPath = path + ".temp"
 
 		out, err := os.Create(newPath)
 		if err != nil {
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxFilenameBytes is the longest name most filesystems accept.
+const maxFilenameBytes = 255
+
+var (
+	ErrInvalidFilename = errors.New("invalid filename")
+	ErrPathEscapes     = errors.New("path escapes the download directory")
+)
+
+// SanitizeFilename turns a filename chosen by a remote user into a plain
+// name that is safe to create in a local directory. Directories are
+// stripped, unicode is normalized to NFC and characters Windows doesn't
+// allow or invalid UTF-8 are replaced. Names with control characters, or with nothing left
+// after cleaning, are rejected with ErrInvalidFilename.
+func SanitizeFilename(name string) (string, error) {
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("%w: %q contains control characters", ErrInvalidFilename, name)
+		}
+	}
+
+	// Both separators are stripped so Windows style paths are caught
+	// everywhere
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	// Some servers still send Latin-1 names
+	name = norm.NFC.String(strings.ToValidUTF8(name, "_"))
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows ignores trailing dots and spaces, and leading dots hide files
+	name = strings.TrimLeft(strings.TrimRight(name, ". "), ". ")
+	if name == "" {
+		return "", fmt.Errorf("%w: nothing left after cleaning", ErrInvalidFilename)
+	}
+
+	if len(name) > maxFilenameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFilenameBytes/2 {
+			ext = ""
+		}
+		name = truncateUTF8(strings.TrimSuffix(name, ext), maxFilenameBytes-len(ext)) + ext
+	}
+
+	return name, nil
+}
+
+// SafeJoin joins name to dir and verifies the result stays inside dir.
+func SafeJoin(dir, name string) (string, error) {
+	joined := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, joined)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q", ErrPathEscapes, name)
+	}
+	return joined, nil
+}
+
+// UniquePath sanitizes name and returns a path for it inside dir that no
+// existing file uses. Collisions get a " (1)", " (2)", ... suffix. The
+// ".temp" file used while downloading counts as a collision too.
+func UniquePath(dir, name string) (string, error) {
+	name, err := SanitizeFilename(name)
+	if err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		path, err := SafeJoin(dir, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists(path) && !exists(path+".temp") {
+			return path, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
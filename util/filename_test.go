@@ -0,0 +1,91 @@
+package util
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"The Great Gatsby.epub", "The Great Gatsby.epub"},
+		{"../../.bashrc", "bashrc"},
+		{"/etc/passwd", "passwd"},
+		{`..\..\Windows\System32\evil.dll`, "evil.dll"},
+		{"books/../../../tmp/x.epub", "x.epub"},
+		{"Café.epub", "Café.epub"},
+		{`what? "really": <yes>|*.epub`, "what_ _really__ _yes___.epub"},
+		{"trailing dots...", "trailing dots"},
+		{"Latin1 \xe9t\xe9.epub", "Latin1 _t_.epub"},
+		{strings.Repeat("é", 200) + ".epub", strings.Repeat("é", 125) + ".epub"},
+	}
+
+	for _, c := range cases {
+		name, err := SanitizeFilename(c.name)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, name, c.name)
+	}
+
+	for _, name := range []string{"", ".", "..", "../", "dir/", "  ", "evil\x00.epub", "line\nbreak.epub", "bell\a.epub", "del\x7f.epub"} {
+		_, err := SanitizeFilename(name)
+		assert.ErrorIs(t, err, ErrInvalidFilename, name)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dir := t.TempDir()
+
+	path, err := SafeJoin(dir, "book.epub")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "book.epub"), path)
+
+	for _, name := range []string{"..", "../book.epub", "a/../../book.epub", ""} {
+		_, err := SafeJoin(dir, name)
+		assert.ErrorIs(t, err, ErrPathEscapes, name)
+	}
+}
+
+func TestUniquePath(t *testing.T) {
+	dir := t.TempDir()
+
+	path, err := UniquePath(dir, "../book.epub")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "book.epub"), path)
+
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "book (1).epub.temp"), nil, 0644))
+
+	path, err = UniquePath(dir, "book.epub")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "book (2).epub"), path)
+}
+
+func TestExtractArchiveHostileEntry(t *testing.T) {
+	dir := t.TempDir()
+	booksDir := filepath.Join(dir, "books")
+	require.NoError(t, os.Mkdir(booksDir, 0755))
+
+	archivePath := filepath.Join(booksDir, "book.zip.temp")
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	writer := zip.NewWriter(file)
+	entry, err := writer.Create("../../.bashrc")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte("echo pwned"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, file.Close())
+
+	extracted, err := ExtractArchive(archivePath)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(booksDir, "bashrc.temp"), extracted)
+	assert.NoFileExists(t, filepath.Join(dir, ".bashrc"))
+}
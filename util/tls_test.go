@@ -0,0 +1,24 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePin(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+	base64 := "q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s="
+
+	for _, pin := range []string{hex, "sha256/" + hex, base64, "sha256/" + base64, " " + base64 + " "} {
+		decoded, err := parsePin(pin)
+		assert.NoError(t, err, pin)
+		assert.Len(t, decoded, 32, pin)
+	}
+
+	for _, pin := range []string{"", "sha256/", "abcd", "not a pin"} {
+		_, err := parsePin(pin)
+		assert.Error(t, err, pin)
+	}
+}